@@ -25,6 +25,8 @@ func BenchmarkCharClass(b *testing.B) {
 		{"C8", C("abcdefgh")},
 		{"C16", C("abcdefghijklmnop")},
 		{"Cx", C("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")},
+		{"Or", Or(Range('0', '9'), Range('A', 'Z'), Range('a', 'z'), C("_"))},
+		{"Not", Not(">:;@")},
 	}
 	for _, te := range tests {
 		b.Run(te.name, func(b *testing.B) {
@@ -58,6 +60,43 @@ func BenchmarkSip(b *testing.B) {
 		`"0333334444"<sip:[2001:30:fe::4:123]>;user=phone`,
 	}
 
+	pat := Block(
+		Repeat(0, 1,
+			S(`"`),
+			Ch(1, 256, Not(`"`)),
+			S(`"`),
+			Ch(0, 256, C(" ")),
+		),
+		S("<"),
+		Any(
+			S("sip"),
+			S("tel"),
+			S("sips"),
+		),
+		S(":"),
+		Repeat(0, 1,
+			Ch(1, 256, Not("@")),
+			S("@"),
+		),
+		Any(
+			Block(
+				S("["),
+				Ch(1, 256, Alnum(), C(":")),
+				S("]"),
+			),
+			Ch(0, 256, Not(">:")),
+		),
+		Repeat(0, 1,
+			S(":"),
+			Ch(1, 5, Digit()),
+		),
+		S(">"),
+		Repeat(0, 1,
+			S(";"),
+			Ch(0, 256, All()),
+		),
+	)
+
 	b.Run("regexp", func(b *testing.B) {
 		re := regexp.MustCompile(`^["]{0,1}([^"]*)["]{0,1}[ ]*<(sip|tel|sips):(([^@]*)@){0,1}([^>^:]*|\[[a-fA-F0-9:]*\]):{0,1}([0-9]*){0,1}>(;.*){0,1}$`)
 		b.ResetTimer()
@@ -68,50 +107,32 @@ func BenchmarkSip(b *testing.B) {
 		}
 	})
 	b.Run("pat", func(b *testing.B) {
-		pat := Block(
-			Repeat(0, 1,
-				S(`"`),
-				Ch(1, 256, Not(`"`)),
-				S(`"`),
-				Ch(0, 256, C(" ")),
-			),
-			S("<"),
-			Any(
-				S("sip"),
-				S("tel"),
-				S("sips"),
-			),
-			S(":"),
-			Repeat(0, 1,
-				Ch(1, 256, Not("@")),
-				S("@"),
-			),
-			Any(
-				Block(
-					S("["),
-					Ch(1, 256, Alnum(), C(":")),
-					S("]"),
-				),
-				Ch(0, 256, Not(">:")),
-			),
-			Repeat(0, 1,
-				S(":"),
-				Ch(1, 5, Digit()),
-			),
-			S(">"),
-			Repeat(0, 1,
-				S(";"),
-				Ch(0, 256, All()),
-			),
-		)
-		b.ResetTimer()
 		for n := 0; n < b.N; n++ {
 			for i, l := 0, len(tests); i < l; i++ {
 				pat(tests[i], 0)
 			}
 		}
 	})
+	b.Run("optimize", func(b *testing.B) {
+		opt := Optimize(pat)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			for i, l := 0, len(tests); i < l; i++ {
+				opt(tests[i], 0)
+			}
+		}
+	})
 }
 
 // BenchmarkSpeed/regexp-4         	  199252	      5916 ns/op	       0 B/op	       0 allocs/op
 // BenchmarkSpeed/pat-4         	  899504	      1263 ns/op	       0 B/op	       0 allocs/op
+
+func BenchmarkFindIndexParallel(b *testing.B) {
+	pat := Block(S("<sip:"), Ch(1, 32, Not("@>")), S("@"), Ch(1, 32, Not(">:")))
+	s := `"display_name"<sip:0312341234@10.0.0.1:5060>;user=phone;hogehoge`
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			FindIndex(nil, pat, s, 0)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package patb
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+// bstr は b をコピーせずに string として参照します.
+//
+// Pattern は受け取った文字列を保持しないので, 評価中に b を変更しなければ安全です.
+func bstr(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// EqualBytes は b が pat と完全に一致するかを返します.
+//
+// Equal の []byte 版です. b を string にコピーせずに評価します.
+func EqualBytes(pat Pattern, b []byte) bool {
+	return Equal(pat, bstr(b))
+}
+
+// MatchBytes は b の中に pat と一致する部分があるかを返します.
+func MatchBytes(c CharClass, pat Pattern, b []byte) bool {
+	return Match(c, pat, bstr(b))
+}
+
+// FindIndexBytes は b[i:] から pat に一致する範囲を返します.
+// パターンに一致したバイト列は b[f:l] です.
+// 一致する部分がなければ -1, -1 を返します.
+func FindIndexBytes(c CharClass, pat Pattern, b []byte, i int) (f int, l int) {
+	return FindIndex(c, pat, bstr(b), i)
+}
+
+// FindAllFuncBytes は b の中から pat と一致する部分を fn に渡します.
+// fn が error を返すとそのエラーを返します.
+func FindAllFuncBytes(c CharClass, pat Pattern, b []byte, fn func(m []byte) error) error {
+	var err error
+	fd := finderOf(c, pat)
+	fd.all(bstr(b), false, func(f, l int) bool {
+		err = fn(b[f:l:l])
+		return err == nil
+	})
+	return err
+}
+
+// FindSubmatchIndexBytes は b[i:] から pat に一致する範囲とサブマッチの範囲を返します.
+// 戻り値の内容は FindSubmatchIndex と同じです.
+func FindSubmatchIndexBytes(c CharClass, pat Pattern, b []byte, i int) []int {
+	return FindSubmatchIndex(c, pat, bstr(b), i)
+}
+
+// FindSubmatchBytes は b[i:] から pat に一致するバイト列とサブマッチのバイト列を返します.
+//
+// マッチしなかったサブマッチは nil です.
+// 一致する部分がなければ nil を返します.
+func FindSubmatchBytes(c CharClass, pat Pattern, b []byte, i int) [][]byte {
+	m := FindSubmatchIndexBytes(c, pat, b, i)
+	if m == nil {
+		return nil
+	}
+	v := make([][]byte, len(m)/2)
+	for k := range v {
+		if f, l := m[2*k], m[2*k+1]; f >= 0 {
+			v[k] = b[f:l:l]
+		}
+	}
+	return v
+}
+
+// ReplaceWriteBytes は Writer を使ってバイト列を置換します.
+//
+// ReplaceWrite の []byte 版です.
+// コールバック関数はパターンに一致したバイト列を受け取り, 対応する置換バイト列を Writer に書き込みます.
+// コールバック関数が SkipAll を返すと, 以降の置換をスキップします.
+// それ以外の error を返された場合, ReplaceWriteBytes はその error を返します.
+func ReplaceWriteBytes(w Writer, c CharClass, pat Pattern, b []byte, fn func(w Writer, m []byte) error) error {
+	var err error
+	i := 0
+	fd := finderOf(c, pat)
+	fd.all(bstr(b), false, func(f, l int) bool {
+		if i < f {
+			w.Write(b[i:f])
+		}
+		err, i = fn(w, b[f:l:l]), l
+		return err == nil
+	})
+	if err != nil && err != SkipAll {
+		return err
+	}
+	w.Write(b[i:])
+	return nil
+}
+
+// ReplaceAllBytes は src の pat に一致する部分をすべて repl に置き換えたバイト列を返します.
+func ReplaceAllBytes(c CharClass, pat Pattern, src, repl []byte) []byte {
+	w := bytes.NewBuffer(make([]byte, 0, len(src)))
+	ReplaceWriteBytes(w, c, pat, src, func(w Writer, _ []byte) error {
+		w.Write(repl)
+		return nil
+	})
+	return w.Bytes()
+}
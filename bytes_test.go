@@ -0,0 +1,54 @@
+package patb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	// `(\w+)=(\w*)`
+	pat := Block(Capture(Ch(1, 16, Word())), S("="), Capture(Ch(0, 16, Word())))
+	b := []byte("<sip:a@b>;user=phone;lr=")
+
+	if EqualBytes(pat, b) {
+		t.Errorf("EqualBytes(%q) = true, want false", b)
+	}
+	if !EqualBytes(pat, b[10:20]) {
+		t.Errorf("EqualBytes(%q) = false, want true", b[10:20])
+	}
+	if !MatchBytes(Word(), pat, b) {
+		t.Errorf("MatchBytes(%q) = false, want true", b)
+	}
+	if f, l := FindIndexBytes(Word(), pat, b, 0); f != 10 || l != 20 {
+		t.Errorf("FindIndexBytes(%q) = %d, %d, want 10, 20", b, f, l)
+	}
+
+	var all [][]byte
+	FindAllFuncBytes(Word(), pat, b, func(m []byte) error {
+		all = append(all, m)
+		return nil
+	})
+	if want := [][]byte{[]byte("user=phone"), []byte("lr=")}; !reflect.DeepEqual(all, want) {
+		t.Errorf("FindAllFuncBytes(%q) = %q, want %q", b, all, want)
+	}
+
+	sub := FindSubmatchBytes(Word(), pat, b, 20)
+	if want := [][]byte{[]byte("lr="), []byte("lr"), {}}; !reflect.DeepEqual(sub, want) {
+		t.Errorf("FindSubmatchBytes(%q) = %q, want %q", b, sub, want)
+	}
+
+	w := bytes.NewBuffer(make([]byte, 0, 32))
+	ReplaceWriteBytes(w, Word(), pat, b, func(w Writer, m []byte) error {
+		w.Write(bytes.ToUpper(m))
+		return nil
+	})
+	if got, want := w.String(), "<sip:a@b>;USER=PHONE;LR="; got != want {
+		t.Errorf("ReplaceWriteBytes(%q) = %q, want %q", b, got, want)
+	}
+
+	got := ReplaceAllBytes(Digit(), Ch(1, 16, Digit()), []byte("tel:0312341234;ext=12"), []byte("*"))
+	if want := "tel:*;ext=*"; string(got) != want {
+		t.Errorf("ReplaceAllBytes() = %q, want %q", got, want)
+	}
+}
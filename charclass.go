@@ -1,35 +1,56 @@
 package patb
 
+import (
+	"errors"
+	"unicode"
+)
+
 // CharClass はキャラクタクラスを表します.
 //
 // r が適合するかを判定する関数です.
 type CharClass func(r rune) bool
 
 // C は set のいずれかの文字にマッチする CharClass を返します.
+//
+// 5 文字以上の set は ASCII のビットマップと非 ASCII の範囲表で判定します.
 func C(set string) CharClass {
 	v := []rune(set)
-	l := len(v)
-	if l <= 16 {
-		return cfn[l](v)
+	switch l := len(v); {
+	case l == 0:
+		// 変数を捕捉しないので init で登録しています.
+		return cfn00(v)
+	case l < len(cfn):
+		c := cfn[l](v)
+		register(c, newCharset(v))
+		return c
+	}
+	return newCharset(v).class()
+}
+
+// CFold は大文字小文字を区別せずに set のいずれかの文字にマッチする CharClass を返します.
+//
+// Unicode の単純大文字小文字畳み込みで set と等しい文字にマッチします.
+func CFold(set string) CharClass {
+	var v []rune
+	for _, r := range set {
+		v = append(v, r)
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			v = append(v, f)
+		}
 	}
-	return cmap(v)
+	return C(string(v))
 }
 
 // Not は set 以外の文字にマッチする CharClass を返します.
 func Not(set string) CharClass {
-	c := C(set)
-	return func(r rune) bool {
-		return !c(r)
-	}
+	return Invert(C(set))
 }
 
 // Range は lo, hi の範囲にマッチする CharClass を返します.
 //
 // マッチする範囲に lo, hi を含みます.
 func Range(lo, hi rune) CharClass {
-	return func(r rune) bool {
-		return lo <= r && r <= hi
-	}
+	return newCharset(nil, runeRange{lo, hi}).class()
 }
 
 // All は全ての文字にマッチする CharClass を返します.
@@ -116,190 +137,167 @@ func Space() CharClass {
 	}
 }
 
+// Or は classes のいずれかにマッチする CharClass を返します.
 //
-// Optimized C functions
-//
-
-var cfn = []func(v []rune) CharClass{
-	cfn00,
-	cfn01, cfn02, cfn03, cfn04,
-	cfn05, cfn06, cfn07, cfn08,
-	cfn09, cfn10, cfn11, cfn12,
-	cfn13, cfn14, cfn15, cfn16,
+// classes を指定しないときはどの文字にもマッチしません.
+func Or(classes ...CharClass) CharClass {
+	if len(classes) == 1 {
+		return classes[0]
+	}
+	return union(setsOf(classes)).class()
 }
 
-func cmap(v []rune) CharClass {
-	m := make(map[rune]bool)
-	for _, r := range v {
-		m[r] = true
-	}
-	return func(r rune) bool {
-		return m[r]
+// And は classes のすべてにマッチする CharClass を返します.
+//
+// classes を指定しないときはすべての文字にマッチします.
+//
+//	// `[^>:\s]`
+//	And(Not(">:"), Invert(Space()))
+func And(classes ...CharClass) CharClass {
+	switch len(classes) {
+	case 0:
+		return All()
+	case 1:
+		return classes[0]
 	}
+	return intersect(setsOf(classes)).class()
 }
 
-func cfn00(v []rune) CharClass {
-	return func(r rune) bool {
-		return false
-	}
+// Minus は a にマッチし b にマッチしない CharClass を返します.
+//
+//	// Word のうち数字以外
+//	Minus(Word(), Digit())
+func Minus(a, b CharClass) CharClass {
+	return intersect([]*charset{setOf(a), invert(setOf(b))}).class()
 }
 
-func cfn01(v []rune) CharClass {
-	c00 := v[0]
-	return func(r rune) bool {
-		return r == c00
-	}
+// Invert は c にマッチしない文字にマッチする CharClass を返します.
+func Invert(c CharClass) CharClass {
+	return invert(setOf(c)).class()
 }
 
-func cfn02(v []rune) CharClass {
-	c00, c01 := v[0], v[1]
-	return func(r rune) bool {
-		return r == c00 || r == c01
+// Is は Unicode の範囲表 tables のいずれかに含まれる文字にマッチする CharClass を返します.
+//
+//	Is(unicode.Greek, unicode.Cyrillic)
+func Is(tables ...*unicode.RangeTable) CharClass {
+	var c CharClass
+	if len(tables) == 1 {
+		t := tables[0]
+		c = func(r rune) bool {
+			return unicode.Is(t, r)
+		}
+	} else {
+		c = func(r rune) bool {
+			return unicode.IsOneOf(tables, r)
+		}
 	}
+	return funcset(c, tablesName(tables)).class()
 }
 
-func cfn03(v []rune) CharClass {
-	c00, c01, c02 := v[0], v[1], v[2]
-	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02
-	}
+// Letter は Unicode の文字 (カテゴリ L) にマッチする CharClass を返します.
+func Letter() CharClass {
+	return unicode.IsLetter
 }
 
-func cfn04(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03
-	}
+// Number は Unicode の数字 (カテゴリ N) にマッチする CharClass を返します.
+//
+// 全角数字や漢数字以外の数字記号を含みます.
+func Number() CharClass {
+	return unicode.IsNumber
 }
 
-func cfn05(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04 := v[4]
-	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04
-	}
+// Punct は Unicode の句読点 (カテゴリ P) にマッチする CharClass を返します.
+func Punct() CharClass {
+	return unicode.IsPunct
 }
 
-func cfn06(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05 := v[4], v[5]
-	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05
+// Script は Unicode の用字 name の文字にマッチする CharClass を返します.
+//
+// name は "Han", "Hiragana", "Latin" など unicode.Scripts のキーです.
+// 存在しない name を指定するとエラーを返します.
+//
+//	// 設定ファイルで指定した用字
+//	c, err := Script(conf.Script)
+func Script(name string) (CharClass, error) {
+	t, ok := unicode.Scripts[name]
+	if !ok {
+		return nil, errors.New("patb: unknown script " + name)
 	}
+	return Is(t), nil
 }
 
-func cfn07(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05, c06 := v[4], v[5], v[6]
-	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05 || r == c06
+// MustScript は Script と同じですが, 存在しない name を指定すると panic します.
+func MustScript(name string) CharClass {
+	c, err := Script(name)
+	if err != nil {
+		panic(err)
 	}
+	return c
 }
 
-func cfn08(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05, c06, c07 := v[4], v[5], v[6], v[7]
-	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05 || r == c06 || r == c07
-	}
+// Hiragana はひらがなにマッチする CharClass を返します.
+func Hiragana() CharClass {
+	return Is(unicode.Hiragana)
 }
 
-func cfn09(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05, c06, c07 := v[4], v[5], v[6], v[7]
-	c08 := v[8]
-	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05 || r == c06 || r == c07 ||
-			r == c08
-	}
+// Katakana はカタカナにマッチする CharClass を返します.
+//
+// 長音符 ー (U+30FC) は用字が Common なので含みません.
+func Katakana() CharClass {
+	return Is(unicode.Katakana)
 }
 
-func cfn10(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05, c06, c07 := v[4], v[5], v[6], v[7]
-	c08, c09 := v[8], v[9]
-	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05 || r == c06 || r == c07 ||
-			r == c08 || r == c09
-	}
+// Han は漢字にマッチする CharClass を返します.
+func Han() CharClass {
+	return Is(unicode.Han)
 }
 
-func cfn11(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05, c06, c07 := v[4], v[5], v[6], v[7]
-	c08, c09, c10 := v[8], v[9], v[10]
+// FullDigit は全角数字 ０-９ にマッチする CharClass を返します.
+func FullDigit() CharClass {
 	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05 || r == c06 || r == c07 ||
-			r == c08 || r == c09 || r == c10
+		return '０' <= r && r <= '９'
 	}
 }
 
-func cfn12(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05, c06, c07 := v[4], v[5], v[6], v[7]
-	c08, c09, c10, c11 := v[8], v[9], v[10], v[11]
+//
+// Optimized C functions
+//
+
+var cfn = []func(v []rune) CharClass{
+	cfn00,
+	cfn01, cfn02, cfn03, cfn04,
+}
+
+func cfn00(v []rune) CharClass {
 	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05 || r == c06 || r == c07 ||
-			r == c08 || r == c09 || r == c10 || r == c11
+		return false
 	}
 }
 
-func cfn13(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05, c06, c07 := v[4], v[5], v[6], v[7]
-	c08, c09, c10, c11 := v[8], v[9], v[10], v[11]
-	c12 := v[12]
+func cfn01(v []rune) CharClass {
+	c00 := v[0]
 	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05 || r == c06 || r == c07 ||
-			r == c08 || r == c09 || r == c10 || r == c11 ||
-			r == c12
+		return r == c00
 	}
 }
 
-func cfn14(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05, c06, c07 := v[4], v[5], v[6], v[7]
-	c08, c09, c10, c11 := v[8], v[9], v[10], v[11]
-	c12, c13 := v[12], v[13]
+func cfn02(v []rune) CharClass {
+	c00, c01 := v[0], v[1]
 	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05 || r == c06 || r == c07 ||
-			r == c08 || r == c09 || r == c10 || r == c11 ||
-			r == c12 || r == c13
+		return r == c00 || r == c01
 	}
 }
 
-func cfn15(v []rune) CharClass {
-	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05, c06, c07 := v[4], v[5], v[6], v[7]
-	c08, c09, c10, c11 := v[8], v[9], v[10], v[11]
-	c12, c13, c14 := v[12], v[13], v[14]
+func cfn03(v []rune) CharClass {
+	c00, c01, c02 := v[0], v[1], v[2]
 	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05 || r == c06 || r == c07 ||
-			r == c08 || r == c09 || r == c10 || r == c11 ||
-			r == c12 || r == c13 || r == c14
+		return r == c00 || r == c01 || r == c02
 	}
 }
 
-func cfn16(v []rune) CharClass {
+func cfn04(v []rune) CharClass {
 	c00, c01, c02, c03 := v[0], v[1], v[2], v[3]
-	c04, c05, c06, c07 := v[4], v[5], v[6], v[7]
-	c08, c09, c10, c11 := v[8], v[9], v[10], v[11]
-	c12, c13, c14, c15 := v[12], v[13], v[14], v[15]
 	return func(r rune) bool {
-		return r == c00 || r == c01 || r == c02 || r == c03 ||
-			r == c04 || r == c05 || r == c06 || r == c07 ||
-			r == c08 || r == c09 || r == c10 || r == c11 ||
-			r == c12 || r == c13 || r == c14 || r == c15
+		return r == c00 || r == c01 || r == c02 || r == c03
 	}
 }
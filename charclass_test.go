@@ -1,6 +1,12 @@
 package patb
 
-import "testing"
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+	"unicode"
+)
 
 func TestCharClass(t *testing.T) {
 	tests := []struct {
@@ -28,6 +34,13 @@ func TestCharClass(t *testing.T) {
 			'0': true, 'A': true, 'a': true, 'z': true,
 			'あ': false, ' ': false, '\n': false,
 		}},
+		{`CFold("aσ")`, CFold("aσ"), map[rune]bool{
+			'a': true, 'A': true, 'z': false, 'σ': true,
+			'Σ': true, 'ς': true, '\n': false,
+		}},
+		{`CFold("k")`, CFold("k"), map[rune]bool{
+			'k': true, 'K': true, '\u212A': true, 'j': false,
+		}},
 		{`Not("0Aaあ")`, Not("0Aaあ"), map[rune]bool{
 			'0': false, 'A': false, 'a': false, 'z': true,
 			'あ': false, ' ': true, '\n': true,
@@ -72,6 +85,70 @@ func TestCharClass(t *testing.T) {
 			'0': false, 'A': false, 'a': false, 'z': false,
 			'あ': false, ' ': true, '\n': true,
 		}},
+		{`Or()`, Or(), map[rune]bool{
+			'0': false, 'a': false, 'あ': false,
+		}},
+		{`Or(Digit(), C("あ"))`, Or(Digit(), C("あ")), map[rune]bool{
+			'0': true, 'a': false, 'あ': true, ' ': false,
+		}},
+		{`And()`, And(), map[rune]bool{
+			'0': true, 'a': true, 'あ': true,
+		}},
+		{`And(Not(">:"), Invert(Space()))`, And(Not(">:"), Invert(Space())), map[rune]bool{
+			'0': true, '>': false, ':': false, ' ': false, '\n': false, 'あ': true,
+		}},
+		{`Minus(Word(), Digit())`, Minus(Word(), Digit()), map[rune]bool{
+			'0': false, 'a': true, '_': true, ' ': false,
+		}},
+		{`Invert(Alnum())`, Invert(Alnum()), map[rune]bool{
+			'0': false, 'a': false, '_': true, 'あ': true,
+		}},
+		{`Or(Range('a', 'c'), Range('ぁ', 'ゖ'), C("xyz漢字"))`, Or(Range('a', 'c'), Range('ぁ', 'ゖ'), C("xyz漢字")), map[rune]bool{
+			'a': true, 'c': true, 'd': false, 'y': true, 'ぁ': true, 'ゖ': true,
+			'ア': false, '漢': true, '字': true, '語': false,
+		}},
+		{`Or(Range('0', '9'), Letter())`, Or(Range('0', '9'), Letter()), map[rune]bool{
+			'0': true, 'a': true, '_': false, 'あ': true, '・': false,
+		}},
+		{`Invert(Range('\x00', 'あ'))`, Invert(Range('\x00', 'あ')), map[rune]bool{
+			'0': false, 'z': false, 'ぁ': false, 'あ': false, 'ぃ': true, '\U0010FFFF': true,
+		}},
+		{`Minus(Range('ぁ', 'ゖ'), C("ゑゐ"))`, Minus(Range('ぁ', 'ゖ'), C("ゑゐ")), map[rune]bool{
+			'a': false, 'ぁ': true, 'ゑ': false, 'ゐ': false, 'ゖ': true,
+		}},
+		{`And(Not("ab"), Invert(Letter()))`, And(Not("ab"), Invert(Letter())), map[rune]bool{
+			'a': false, 'c': false, '0': true, 'あ': false, '、': true,
+		}},
+		{`Is(unicode.Greek, unicode.Cyrillic)`, Is(unicode.Greek, unicode.Cyrillic), map[rune]bool{
+			'a': false, 'α': true, 'Ж': true, 'あ': false,
+		}},
+		{`Letter()`, Letter(), map[rune]bool{
+			'0': false, 'A': true, 'é': true, 'あ': true,
+			'漢': true, '・': false, ' ': false,
+		}},
+		{`Number()`, Number(), map[rune]bool{
+			'0': true, 'A': false, '５': true, 'Ⅷ': true,
+			'五': false, ' ': false,
+		}},
+		{`Punct()`, Punct(), map[rune]bool{
+			'.': true, '-': true, '、': true, '「': true,
+			'a': false, '+': false,
+		}},
+		{`MustScript("Han")`, MustScript("Han"), map[rune]bool{
+			'a': false, 'あ': false, 'ア': false, '漢': true, '々': true,
+		}},
+		{`Hiragana()`, Hiragana(), map[rune]bool{
+			'a': false, 'あ': true, 'ゑ': true, 'ア': false, '漢': false, 'ー': false,
+		}},
+		{`Katakana()`, Katakana(), map[rune]bool{
+			'a': false, 'あ': false, 'ア': true, 'ｱ': true, '漢': false, 'ー': false,
+		}},
+		{`Han()`, Han(), map[rune]bool{
+			'a': false, 'あ': false, '漢': true,
+		}},
+		{`FullDigit()`, FullDigit(), map[rune]bool{
+			'0': false, '０': true, '９': true, '五': false,
+		}},
 	}
 	for _, te := range tests {
 		for r, want := range te.want {
@@ -82,3 +159,56 @@ func TestCharClass(t *testing.T) {
 		}
 	}
 }
+
+func TestScript(t *testing.T) {
+	if c, err := Script("Hiragana"); err != nil {
+		t.Errorf("Script(Hiragana) errored %v", err)
+	} else if !c('あ') || c('ア') {
+		t.Errorf("Script(Hiragana) ('あ', 'ア') = %t, %t, want true, false", c('あ'), c('ア'))
+	}
+	if c, err := Script("Klingon"); c != nil || err == nil {
+		t.Errorf("Script(Klingon) = %v, want error", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustScript(Klingon) did not panic")
+		}
+	}()
+	MustScript("Klingon")
+}
+
+func TestCharClassRelease(t *testing.T) {
+	keep := C("abc")
+	before := count(&knownClass)
+	for i := 0; i < 10000; i++ {
+		Or(C("xyz"), Not("abcdefgh"), Range('a', rune('a'+i%26)))
+	}
+	if !released(&knownClass, before) {
+		t.Errorf("knownClass has %d entries, want <= %d", count(&knownClass), before+100)
+	}
+	if cs := setOf(keep); cs.rest != nil || !cs.has('a') || cs.has('d') {
+		t.Errorf("setOf(C(abc)) = %v", cs)
+	}
+}
+
+// count は m に登録されている数を返します.
+func count(m *sync.Map) int {
+	n := 0
+	m.Range(func(key, value any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// released は m の登録が before+100 以下に減るまで GC を繰り返して待ちます.
+func released(m *sync.Map, before int) bool {
+	for try := 0; try < 100; try++ {
+		runtime.GC()
+		if count(m) <= before+100 {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package patb
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"unicode/utf8"
+	"unsafe"
+	"weak"
+)
+
+// charset はコンパイルしたキャラクタクラスです.
+//
+// ASCII は 128 ビットのビットマップで, 非 ASCII はソートした範囲で判定します.
+// 範囲で表せないキャラクタクラスから作った charset は非 ASCII を rest で判定します.
+type charset struct {
+	ascii  [2]uint64
+	ranges []runeRange // 非 ASCII の範囲 (昇順, 重複なし)
+	rest   CharClass   // nil でなければ非 ASCII は rest で判定します
+	name   string      // rest を持つ charset の正規表現の表記
+}
+
+// runeRange は lo, hi を含む文字の範囲です.
+type runeRange struct {
+	lo, hi rune
+}
+
+// knownClass は patb が作った CharClass の charset です.
+//
+// キーは funcKey で, 値は classEntry です. CharClass が解放されると登録を削除します.
+// 変数を捕捉しない CharClass は解放されないので, static で charset をそのまま登録します.
+var knownClass sync.Map
+
+// classEntry は knownClass に登録した CharClass の charset です.
+type classEntry struct {
+	fn weak.Pointer[byte] // 登録した CharClass
+	cs *charset
+}
+
+// funcKey は関数 f を識別するキーを返します.
+//
+// コードポインタと異なり, 同じ関数リテラルから作ったクロージャでもそれぞれ別のキーになります.
+// 変数を捕捉しない関数は常に同じキーになります.
+// キーは f の解放を妨げません.
+func funcKey[F CharClass | Pattern](f F) uintptr {
+	return uintptr(funcPtr(f))
+}
+
+// funcPtr は関数 f が指すクロージャのポインタを返します.
+func funcPtr[F CharClass | Pattern](f F) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&f))
+}
+
+// register は c の charset を cs として登録します.
+//
+// c が解放されると登録を削除します. 削除する前に同じアドレスに作られた関数は,
+// fn が nil になっていることで登録した CharClass と区別します.
+func register(c CharClass, cs *charset) {
+	p := (*byte)(funcPtr(c))
+	key := uintptr(unsafe.Pointer(p))
+	e := &classEntry{fn: weak.Make(p), cs: cs}
+	knownClass.Store(key, e)
+	runtime.AddCleanup(p, func(key uintptr) {
+		knownClass.CompareAndDelete(key, e)
+	}, key)
+}
+
+// newCharset は runes と ranges にマッチする charset を返します.
+func newCharset(runes []rune, ranges ...runeRange) *charset {
+	for _, r := range runes {
+		ranges = append(ranges, runeRange{r, r})
+	}
+	cs := &charset{}
+	for _, rg := range ranges {
+		for r := rg.lo; r <= rg.hi && r < utf8.RuneSelf; r++ {
+			cs.ascii[r>>6] |= 1 << (r & 63)
+		}
+		if rg.hi >= utf8.RuneSelf {
+			if rg.lo < utf8.RuneSelf {
+				rg.lo = utf8.RuneSelf
+			}
+			cs.ranges = append(cs.ranges, rg)
+		}
+	}
+	cs.ranges = normalize(cs.ranges)
+	return cs
+}
+
+// setOf は c の charset を返します.
+//
+// charset から作った CharClass でなければ, ASCII を c で評価して
+// 非 ASCII を c で判定する charset を返します.
+func setOf(c CharClass) *charset {
+	v, _ := knownClass.Load(funcKey(c))
+	switch v := v.(type) {
+	case *charset:
+		return v
+	case *classEntry:
+		if v.fn.Value() != nil {
+			return v.cs
+		}
+	}
+	return funcset(c, "")
+}
+
+// funcset は ASCII を c で評価したビットマップで, 非 ASCII を c で判定する charset を返します.
+//
+// name は c の正規表現の表記です.
+func funcset(c CharClass, name string) *charset {
+	cs := &charset{rest: c, name: name}
+	for r := rune(0); r < utf8.RuneSelf; r++ {
+		if c(r) {
+			cs.ascii[r>>6] |= 1 << (r & 63)
+		}
+	}
+	return cs
+}
+
+// static は c の charset を cs として登録します.
+//
+// c は変数を捕捉しない関数でなければなりません.
+func static(c CharClass, cs *charset) {
+	knownClass.Store(funcKey(c), cs)
+}
+
+func init() {
+	static(C(""), newCharset(nil))
+	static(All(), newCharset(nil, runeRange{0, utf8.MaxRune}))
+	static(Digit(), newCharset(nil, runeRange{'0', '9'}))
+	static(Lower(), newCharset(nil, runeRange{'a', 'z'}))
+	static(Upper(), newCharset(nil, runeRange{'A', 'Z'}))
+	static(Alphabet(), newCharset(nil, runeRange{'A', 'Z'}, runeRange{'a', 'z'}))
+	static(Alnum(), newCharset(nil, runeRange{'0', '9'}, runeRange{'A', 'Z'}, runeRange{'a', 'z'}))
+	static(Word(), newCharset([]rune("_"), runeRange{'0', '9'}, runeRange{'A', 'Z'}, runeRange{'a', 'z'}))
+	static(Blank(), newCharset([]rune(" \t")))
+	static(Space(), newCharset([]rune(" \t\n\r\f")))
+	static(FullDigit(), newCharset(nil, runeRange{'０', '９'}))
+	static(Letter(), funcset(Letter(), `\pL`))
+	static(Number(), funcset(Number(), `\pN`))
+	static(Punct(), funcset(Punct(), `\pP`))
+}
+
+// setsOf は classes の charset を返します.
+func setsOf(classes []CharClass) []*charset {
+	sets := make([]*charset, len(classes))
+	for i, c := range classes {
+		sets[i] = setOf(c)
+	}
+	return sets
+}
+
+// has は r が cs にマッチするかを返します.
+func (cs *charset) has(r rune) bool {
+	if uint32(r) < utf8.RuneSelf {
+		return cs.ascii[r>>6]&(1<<(r&63)) != 0
+	}
+	if cs.rest != nil {
+		return cs.rest(r)
+	}
+	return inRanges(cs.ranges, r)
+}
+
+// class は cs にマッチする CharClass を返します.
+func (cs *charset) class() CharClass {
+	ascii, ranges, rest := cs.ascii, cs.ranges, cs.rest
+	var c CharClass
+	switch {
+	case rest != nil:
+		c = func(r rune) bool {
+			if uint32(r) < utf8.RuneSelf {
+				return ascii[r>>6]&(1<<(r&63)) != 0
+			}
+			return rest(r)
+		}
+	case len(ranges) == 0:
+		c = func(r rune) bool {
+			if uint32(r) < utf8.RuneSelf {
+				return ascii[r>>6]&(1<<(r&63)) != 0
+			}
+			return false
+		}
+	default:
+		c = func(r rune) bool {
+			if uint32(r) < utf8.RuneSelf {
+				return ascii[r>>6]&(1<<(r&63)) != 0
+			}
+			return inRanges(ranges, r)
+		}
+	}
+	register(c, cs)
+	return c
+}
+
+// inRanges は r が ranges に含まれるかを返します.
+func inRanges(ranges []runeRange, r rune) bool {
+	if len(ranges) <= 8 {
+		for _, rg := range ranges {
+			if r < rg.lo {
+				return false
+			}
+			if r <= rg.hi {
+				return true
+			}
+		}
+		return false
+	}
+	lo, hi := 0, len(ranges)
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if rg := ranges[m]; r < rg.lo {
+			hi = m
+		} else if r > rg.hi {
+			lo = m + 1
+		} else {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize は ranges をソートし, 重なりや隣接する範囲をまとめます.
+func normalize(ranges []runeRange) []runeRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].lo < ranges[j].lo
+	})
+	v := ranges[:1]
+	for _, rg := range ranges[1:] {
+		if last := &v[len(v)-1]; rg.lo <= last.hi+1 {
+			if rg.hi > last.hi {
+				last.hi = rg.hi
+			}
+			continue
+		}
+		v = append(v, rg)
+	}
+	return v
+}
+
+// invertRanges は lo 以上の文字のうち ranges に含まれない範囲を返します.
+func invertRanges(ranges []runeRange, lo rune) []runeRange {
+	var v []runeRange
+	for _, rg := range ranges {
+		if lo < rg.lo {
+			v = append(v, runeRange{lo, rg.lo - 1})
+		}
+		lo = rg.hi + 1
+	}
+	if lo <= utf8.MaxRune {
+		v = append(v, runeRange{lo, utf8.MaxRune})
+	}
+	return v
+}
+
+// union は sets のいずれかにマッチする charset を返します.
+func union(sets []*charset) *charset {
+	cs := &charset{}
+	exact := true
+	for _, s := range sets {
+		cs.ascii[0] |= s.ascii[0]
+		cs.ascii[1] |= s.ascii[1]
+		cs.ranges = append(cs.ranges, s.ranges...)
+		exact = exact && s.rest == nil
+	}
+	if !exact {
+		cs.ranges = nil
+		cs.name = unionName(sets)
+		cs.rest = func(r rune) bool {
+			for _, s := range sets {
+				if s.has(r) {
+					return true
+				}
+			}
+			return false
+		}
+		return cs
+	}
+	cs.ranges = normalize(cs.ranges)
+	return cs
+}
+
+// invert は s にマッチしない charset を返します.
+func invert(s *charset) *charset {
+	cs := &charset{ascii: [2]uint64{^s.ascii[0], ^s.ascii[1]}}
+	if s.rest != nil {
+		cs.rest = func(r rune) bool {
+			return !s.rest(r)
+		}
+		cs.name = invertName(s.name)
+		return cs
+	}
+	cs.ranges = invertRanges(s.ranges, utf8.RuneSelf)
+	return cs
+}
+
+// intersect は sets のすべてにマッチする charset を返します.
+func intersect(sets []*charset) *charset {
+	inv := make([]*charset, len(sets))
+	for i, s := range sets {
+		inv[i] = invert(s)
+	}
+	return invert(union(inv))
+}
@@ -0,0 +1,561 @@
+package patb
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SyntaxError は Compile が正規表現を解析できなかったことを表します.
+type SyntaxError struct {
+	Msg  string // エラーの内容
+	Expr string // エラーの箇所
+}
+
+func (e *SyntaxError) Error() string {
+	return "patb: " + e.Msg + ": `" + e.Expr + "`"
+}
+
+// Compile は正規表現 expr とほぼ同じ評価をする Pattern と先頭文字の CharClass を返します.
+//
+// expr は RE2 の次の構文を解析します.
+//
+//	x          文字 x (\ でエスケープした文字を含む)
+//	.          改行以外の任意の 1 文字
+//	[xyz]      キャラクタクラス. a-z の範囲, \d などを含められます
+//	[^xyz]     否定キャラクタクラス
+//	[[:alpha:]]  POSIX クラス. [[:^alpha:]] で否定します
+//	\d \D      0-9 とそれ以外
+//	\w \W      0-9, A-Z, a-z, _ とそれ以外
+//	\s \S      空白文字とそれ以外
+//	\t \n \r \f \v \a \x7F \x{10FFFF}
+//	xy         x の後に y
+//	x|y        x または y
+//	x* x+ x?   x の 0 回以上, 1 回以上, 0 回か 1 回の繰り返し
+//	x{n,m}     x の n 回以上 m 回以下の繰り返し. x{n}, x{n,} も使用できます
+//	x*? x+? x?? x{n,m}?  できるだけ少ない回数の繰り返し
+//	^ \A       先頭
+//	$ \z       末尾
+//	\b \B      ASCII の単語の境界とそれ以外
+//	(re)       サブマッチ
+//	(?P<name>re) (?<name>re)  名前付きのサブマッチ
+//	(?:re)     サブマッチにしないグループ
+//
+// 戻り値の Pattern は Backtrack と同じく後戻りしながら評価します.
+// CharClass は FindIndex などに指定する先頭文字のキャラクタクラスです.
+//
+// 空文字列にマッチし得る繰り返しを入れ子にした (?:(?:a?)*(?:b*|.))* のような式では,
+// 空文字列の繰り返しを打ち切る位置が regexp と異なり, マッチする範囲が異なることがあります.
+func Compile(expr string) (Pattern, CharClass, error) {
+	p := parser{expr: expr}
+	pat, err := p.alternate()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(expr) {
+		return nil, nil, &SyntaxError{"unexpected )", expr[p.pos:]}
+	}
+	n := nodeOf(Backtrack(pat))
+	return n.pat, n.leading(), nil
+}
+
+// MustCompile は Compile と同じですが, expr を解析できなければ panic します.
+func MustCompile(expr string) (Pattern, CharClass) {
+	pat, c, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return pat, c
+}
+
+// ClassOf はキャラクタクラスの構文 expr と同じ評価をする CharClass を返します.
+//
+// expr は [a-zA-Z0-9_.-] などの角括弧の式か \d, \w, \s などのエスケープです.
+// 角括弧の中では範囲, ^ による否定, エスケープ, [:alpha:] などの POSIX クラスを使用できます.
+// POSIX クラスは alnum, alpha, ascii, blank, cntrl, digit, graph, lower,
+// print, punct, space, upper, word, xdigit で, いずれも ASCII の文字にマッチします.
+//
+//	// Ch(1, 16, Alnum(), C("._-")) と同じ
+//	c, err := ClassOf("[[:alnum:]._-]")
+//	pat := Ch(1, 16, c)
+func ClassOf(expr string) (CharClass, error) {
+	p := parser{expr: expr}
+	var c CharClass
+	var err error
+	switch r := p.next(); r {
+	case '[':
+		c, err = p.class(0)
+	case '\\':
+		if _, c, err = p.escape(0); err == nil && c == nil {
+			err = p.errorf("missing character class", 0)
+		}
+	default:
+		return nil, &SyntaxError{"missing character class", expr}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.more() {
+		return nil, &SyntaxError{"unexpected trailing characters", expr[p.pos:]}
+	}
+	return c, nil
+}
+
+// MustClassOf は ClassOf と同じですが, expr を解析できなければ panic します.
+func MustClassOf(expr string) CharClass {
+	c, err := ClassOf(expr)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// parser は Compile の正規表現を解析します.
+type parser struct {
+	expr string
+	pos  int
+}
+
+func (p *parser) more() bool {
+	return p.pos < len(p.expr)
+}
+
+func (p *parser) peek() rune {
+	r, _ := utf8.DecodeRuneInString(p.expr[p.pos:])
+	return r
+}
+
+func (p *parser) next() rune {
+	r, w := utf8.DecodeRuneInString(p.expr[p.pos:])
+	p.pos += w
+	return r
+}
+
+func (p *parser) errorf(msg string, from int) error {
+	return &SyntaxError{msg, p.expr[from:p.pos]}
+}
+
+// alternate は x|y を解析します.
+func (p *parser) alternate() (Pattern, error) {
+	var pats []Pattern
+	for {
+		pat, err := p.concat()
+		if err != nil {
+			return nil, err
+		}
+		pats = append(pats, pat)
+		if !p.more() || p.peek() != '|' {
+			break
+		}
+		p.next()
+	}
+	if len(pats) == 1 {
+		return pats[0], nil
+	}
+	return Any(pats...), nil
+}
+
+// concat は xy を解析します. 連続する文字はひとつの S にまとめます.
+func (p *parser) concat() (Pattern, error) {
+	var pats []Pattern
+	var lit strings.Builder
+	for p.more() && p.peek() != '|' && p.peek() != ')' {
+		pat, r, err := p.repeat()
+		if err != nil {
+			return nil, err
+		}
+		if pat == nil {
+			lit.WriteRune(r)
+			continue
+		}
+		if lit.Len() > 0 {
+			pats = append(pats, S(lit.String()))
+			lit.Reset()
+		}
+		pats = append(pats, pat)
+	}
+	if lit.Len() > 0 {
+		pats = append(pats, S(lit.String()))
+	}
+	if len(pats) == 1 {
+		return pats[0], nil
+	}
+	return Block(pats...), nil
+}
+
+// repeat は繰り返しを含むひとつの要素を解析します.
+//
+// 要素が繰り返しのない文字のときは nil とその文字を返します.
+func (p *parser) repeat() (Pattern, rune, error) {
+	from := p.pos
+	pat, c, r, err := p.atom()
+	if err != nil {
+		return nil, 0, err
+	}
+	min, max, ok, err := p.quantifier()
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		if pat == nil && c != nil {
+			pat = Ch(1, 1, c)
+		}
+		return pat, r, nil
+	}
+	lazy := p.more() && p.peek() == '?'
+	if lazy {
+		p.next()
+	}
+	if p.more() {
+		switch p.peek() {
+		case '*', '+', '?':
+			p.next()
+			return nil, 0, p.errorf("invalid nested repetition operator", from)
+		case '{':
+			save := p.pos
+			if _, _, ok, _ := p.quantifier(); ok {
+				return nil, 0, p.errorf("invalid nested repetition operator", from)
+			}
+			p.pos = save
+		}
+	}
+	if pat == nil && c == nil {
+		c = C(string(r))
+	}
+	switch {
+	case c != nil && lazy:
+		return ChLazy(min, max, c), 0, nil
+	case c != nil:
+		return Ch(min, max, c), 0, nil
+	case lazy:
+		return RepeatLazy(min, max, pat), 0, nil
+	}
+	return Repeat(min, max, pat), 0, nil
+}
+
+// quantifier は *, +, ?, {n,m} を解析します.
+func (p *parser) quantifier() (min, max uint, ok bool, err error) {
+	if !p.more() {
+		return 0, 0, false, nil
+	}
+	switch p.peek() {
+	case '*':
+		p.next()
+		return 0, Inf, true, nil
+	case '+':
+		p.next()
+		return 1, Inf, true, nil
+	case '?':
+		p.next()
+		return 0, 1, true, nil
+	case '{':
+	default:
+		return 0, 0, false, nil
+	}
+
+	// {n,m} の形式でなければ { は文字として扱います.
+	from := p.pos
+	p.next()
+	n, ok := p.number()
+	if !ok {
+		p.pos = from
+		return 0, 0, false, nil
+	}
+	min, max = n, n
+	if p.more() && p.peek() == ',' {
+		p.next()
+		if p.more() && p.peek() == '}' {
+			max = Inf
+		} else if max, ok = p.number(); !ok {
+			p.pos = from
+			return 0, 0, false, nil
+		}
+	}
+	if !p.more() || p.next() != '}' {
+		p.pos = from
+		return 0, 0, false, nil
+	}
+	if max < min || max != Inf && max > 1000 {
+		return 0, 0, false, p.errorf("invalid repeat count", from)
+	}
+	return min, max, true, nil
+}
+
+// number は 10 進数を解析します.
+func (p *parser) number() (uint, bool) {
+	from := p.pos
+	for p.more() && '0' <= p.peek() && p.peek() <= '9' {
+		p.next()
+	}
+	n, err := strconv.ParseUint(p.expr[from:p.pos], 10, 0)
+	if err != nil {
+		return 0, false
+	}
+	return uint(n), true
+}
+
+// atom は繰り返しを除くひとつの要素を解析します.
+//
+// 要素が文字のときは pat, c に nil, r にその文字を,
+// キャラクタクラスのときは pat に nil, c にそのキャラクタクラスを返します.
+func (p *parser) atom() (pat Pattern, c CharClass, r rune, err error) {
+	from := p.pos
+	switch r = p.next(); r {
+	case '(':
+		return p.group(from)
+	case '[':
+		c, err = p.class(from)
+		return nil, c, 0, err
+	case '.':
+		return nil, Not("\n"), 0, nil
+	case '^':
+		return Head(), nil, 0, nil
+	case '$':
+		return Tail(), nil, 0, nil
+	case '*', '+', '?':
+		return nil, nil, 0, p.errorf("missing argument to repetition operator", from)
+	case '\\':
+		if p.more() {
+			switch p.peek() {
+			case 'A':
+				p.next()
+				return Head(), nil, 0, nil
+			case 'z':
+				p.next()
+				return Tail(), nil, 0, nil
+			case 'b':
+				p.next()
+				return WordBoundary(), nil, 0, nil
+			case 'B':
+				p.next()
+				return NotWordBoundary(), nil, 0, nil
+			}
+		}
+		r, c, err = p.escape(from)
+		return nil, c, r, err
+	}
+	return nil, nil, r, nil
+}
+
+// group は (re), (?:re), (?P<name>re) を解析します.
+func (p *parser) group(from int) (Pattern, CharClass, rune, error) {
+	name, capture := "", true
+	if strings.HasPrefix(p.expr[p.pos:], "?:") {
+		p.pos += 2
+		capture = false
+	} else if strings.HasPrefix(p.expr[p.pos:], "?P<") || strings.HasPrefix(p.expr[p.pos:], "?<") {
+		p.pos += strings.IndexByte(p.expr[p.pos:], '<') + 1
+		end := strings.IndexByte(p.expr[p.pos:], '>')
+		if end < 0 {
+			p.pos = len(p.expr)
+			return nil, nil, 0, p.errorf("invalid named capture", from)
+		}
+		name = p.expr[p.pos : p.pos+end]
+		p.pos += end + 1
+		if !isName(name) {
+			return nil, nil, 0, p.errorf("invalid named capture", from)
+		}
+	} else if p.more() && p.peek() == '?' {
+		p.next()
+		return nil, nil, 0, p.errorf("invalid or unsupported Perl syntax", from)
+	}
+	pat, err := p.alternate()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if !p.more() {
+		return nil, nil, 0, p.errorf("missing closing )", from)
+	}
+	p.next()
+	if capture {
+		pat = NamedCapture(name, pat)
+	}
+	return pat, nil, 0, nil
+}
+
+// isName はサブマッチの名前に使用できるかを返します.
+func isName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && !('0' <= r && r <= '9') && !('A' <= r && r <= 'Z') && !('a' <= r && r <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// class は [...] を解析します.
+func (p *parser) class(from int) (CharClass, error) {
+	negate := false
+	if p.more() && p.peek() == '^' {
+		p.next()
+		negate = true
+	}
+	var classes []CharClass
+	var set []rune
+	for first := true; ; first = false {
+		if !p.more() {
+			return nil, p.errorf("missing closing ]", from)
+		}
+		lo := p.pos
+		r := p.next()
+		if r == ']' && !first {
+			break
+		}
+		if r == '[' && strings.HasPrefix(p.expr[p.pos:], ":") {
+			if c, err := p.posix(lo); err != nil {
+				return nil, err
+			} else if c != nil {
+				classes = append(classes, c)
+				continue
+			}
+		}
+		if r == '\\' {
+			var c CharClass
+			var err error
+			if r, c, err = p.escape(lo); err != nil {
+				return nil, err
+			} else if c != nil {
+				classes = append(classes, c)
+				continue
+			}
+		}
+		if !p.more() || p.peek() != '-' || strings.HasPrefix(p.expr[p.pos:], "-]") {
+			set = append(set, r)
+			continue
+		}
+		p.next()
+		hi := p.next()
+		if hi == '\\' {
+			var c CharClass
+			var err error
+			if hi, c, err = p.escape(p.pos - 1); err != nil {
+				return nil, err
+			} else if c != nil {
+				return nil, p.errorf("invalid character class range", lo)
+			}
+		}
+		if hi < r {
+			return nil, p.errorf("invalid character class range", lo)
+		}
+		classes = append(classes, Range(r, hi))
+	}
+	if len(set) > 0 {
+		classes = append(classes, C(string(set)))
+	}
+	if negate {
+		return Invert(Or(classes...)), nil
+	}
+	return Or(classes...), nil
+}
+
+// posix は [:alpha:] などの POSIX クラスを解析します.
+//
+// :] で閉じていなければ [ を文字として扱うために nil を返します.
+func (p *parser) posix(from int) (CharClass, error) {
+	end := strings.Index(p.expr[p.pos:], ":]")
+	if end < 0 {
+		return nil, nil
+	}
+	name := p.expr[p.pos+1 : p.pos+end]
+	p.pos += end + 2
+	negate := strings.HasPrefix(name, "^")
+	if negate {
+		name = name[1:]
+	}
+	fn, ok := posixClasses[name]
+	if !ok {
+		return nil, p.errorf("invalid character class range", from)
+	}
+	if negate {
+		return Invert(fn()), nil
+	}
+	return fn(), nil
+}
+
+// posixClasses は POSIX クラスの名前と CharClass です.
+var posixClasses = map[string]func() CharClass{
+	"alnum":  Alnum,
+	"alpha":  Alphabet,
+	"ascii":  func() CharClass { return Range(0, 0x7F) },
+	"blank":  Blank,
+	"cntrl":  func() CharClass { return Or(Range(0, 0x1F), C("\x7F")) },
+	"digit":  Digit,
+	"graph":  func() CharClass { return Range('!', '~') },
+	"lower":  Lower,
+	"print":  func() CharClass { return Range(' ', '~') },
+	"punct":  func() CharClass { return Or(Range('!', '/'), Range(':', '@'), Range('[', '`'), Range('{', '~')) },
+	"space":  func() CharClass { return C("\t\n\v\f\r ") },
+	"upper":  Upper,
+	"word":   Word,
+	"xdigit": func() CharClass { return Or(Digit(), Range('A', 'F'), Range('a', 'f')) },
+}
+
+// escape は \ に続くエスケープを解析します.
+//
+// キャラクタクラスのエスケープのときは c にそのキャラクタクラスを返します.
+func (p *parser) escape(from int) (r rune, c CharClass, err error) {
+	if !p.more() {
+		return 0, nil, p.errorf("trailing backslash at end of expression", from)
+	}
+	switch r = p.next(); r {
+	case 'd':
+		return 0, Digit(), nil
+	case 'D':
+		return 0, Invert(Digit()), nil
+	case 'w':
+		return 0, Word(), nil
+	case 'W':
+		return 0, Invert(Word()), nil
+	case 's':
+		return 0, Space(), nil
+	case 'S':
+		return 0, Invert(Space()), nil
+	case 't':
+		return '\t', nil, nil
+	case 'n':
+		return '\n', nil, nil
+	case 'r':
+		return '\r', nil, nil
+	case 'f':
+		return '\f', nil, nil
+	case 'v':
+		return '\v', nil, nil
+	case 'a':
+		return '\a', nil, nil
+	case 'x':
+		return p.hex(from)
+	}
+	if r < utf8.RuneSelf && !('0' <= r && r <= '9') && !('A' <= r && r <= 'Z') && !('a' <= r && r <= 'z') {
+		return r, nil, nil
+	}
+	return 0, nil, p.errorf("invalid escape sequence", from)
+}
+
+// hex は \x7F, \x{10FFFF} を解析します.
+func (p *parser) hex(from int) (rune, CharClass, error) {
+	var digits string
+	if p.more() && p.peek() == '{' {
+		end := strings.IndexByte(p.expr[p.pos:], '}')
+		if end < 0 {
+			p.pos = len(p.expr)
+			return 0, nil, p.errorf("invalid escape sequence", from)
+		}
+		digits = p.expr[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+	} else {
+		if p.pos+2 > len(p.expr) {
+			p.pos = len(p.expr)
+			return 0, nil, p.errorf("invalid escape sequence", from)
+		}
+		digits = p.expr[p.pos : p.pos+2]
+		p.pos += 2
+	}
+	n, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || n > utf8.MaxRune {
+		return 0, nil, p.errorf("invalid escape sequence", from)
+	}
+	return rune(n), nil, nil
+}
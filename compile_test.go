@@ -0,0 +1,168 @@
+package patb
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{`abc`, []string{"abc", "xabcx", "ab", ""}},
+		{`a.c`, []string{"abc", "a\nc", "aあc"}},
+		{`\w{3,5}`, []string{"012abcあいう", "ab", "abcdefg"}},
+		{`[^@]+@(\w+\.)+\w+`, []string{"a@b", "a@b.c", "dum.my@go.dev", "@go.dev"}},
+		{`.*>`, []string{"<a>b>c", "<a", ">"}},
+		{`(a|ab)(c|bcd)(d*)`, []string{"abcd", "abc", "acd"}},
+		{`^(sip|tel|sips):([^@>]*@)?([^>:]*)(:[0-9]{1,5})?$`, []string{"sip:a@b", "sips:b:5060", "tel:0312341234", "http:x"}},
+		{`[a-c\d\-]+x?`, []string{"a-1bx", "-d", "zz"}},
+		{`(?P<user>[^@]+)@(?:\w+)`, []string{"foo@bar", "@bar"}},
+		{`a{2}b{1,}c{,2}`, []string{"aabbc{,2}", "aab"}},
+		{`\x41\x{3042}\.\t`, []string{"Aあ.\t", "Aあx\t"}},
+		{`x*`, []string{"xx", "y", ""}},
+		{`[]a]+|[^]a]+`, []string{"]a]b", "bb]"}},
+		{`[[:alpha:]]+[[:^digit:][:punct:]]`, []string{"abc1", "ab.", "12", "a:b"}},
+		{`[[:x]+`, []string{"[x:]", "ab"}},
+		{`\bfoo\b|\Bx`, []string{"a foo", "foobar", "ax", "x"}},
+		{`<.*?>`, []string{"<a><b>", "<a", "x>"}},
+		{`(a+?)(a*)(b??)(b*)`, []string{"aaabb", "ab", "b"}},
+		{`(?:ab)*?b`, []string{"ababb", "b", "aab"}},
+		{`(x{2,}?)(x*)y`, []string{"xxxxy", "xy"}},
+		{`(|a)+`, []string{"aa", ""}},
+		{`(?:b?|a)*`, []string{"aa", ""}},
+		{`(\d?)+x`, []string{"12x", "x", "12a"}},
+		{`(?:(a)|b?)*c`, []string{"abac", "c", "bbc"}},
+		{`(?:b?|a)*`, []string{"bba", "ba"}},
+		{`(?:c*|a.)+`, []string{"cab a"}},
+		{`(?:b?|a.)+`, []string{"ébab", "bab"}},
+		{`(a*)*`, []string{"", "aa", "b"}},
+		{`(a?)*`, []string{"", "aa"}},
+		{`(|a)*`, []string{"", "aa"}},
+		{`(?:b?|a){2,}`, []string{"aa", "ba"}},
+		{`(?:b?|a){0,3}`, []string{"bba", "ba"}},
+		{`(?:b?|a){2,3}`, []string{"bba", "aa"}},
+		{`(?:((b)*)){0,2}`, []string{"b", "bcc"}},
+		{`[^a]+(.)`, []string{"\xff", "a\xffb", "\xe3\x81a", "\xffあ\x80"}},
+	}
+	for _, te := range tests {
+		pat, c, err := Compile(te.expr)
+		if err != nil {
+			t.Errorf("Compile(`%s`) errored %v", te.expr, err)
+			continue
+		}
+		re := regexp.MustCompile(te.expr)
+		for _, s := range te.want {
+			got := FindSubmatchIndex(c, pat, s, 0)
+			want := re.FindStringSubmatchIndex(s)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Compile(`%s`) (%q) = %v, want %v", te.expr, s, got, want)
+			}
+			if got, want := FindAllIndex(c, pat, s, -1), re.FindAllStringIndex(s, -1); !equalIndex(got, want) {
+				t.Errorf("FindAllIndex(`%s`, %q) = %v, want %v", te.expr, s, got, want)
+			}
+		}
+		if got, want := SubexpNames(pat), re.SubexpNames(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Compile(`%s`) names = %q, want %q", te.expr, got, want)
+		}
+	}
+}
+
+// equalIndex は FindAllIndex と regexp.Regexp.FindAllStringIndex の結果が等しいかを返します.
+func equalIndex(got [][2]int, want [][]int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for k := range got {
+		if got[k][0] != want[k][0] || got[k][1] != want[k][1] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCompileError(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`a**`, "patb: invalid nested repetition operator: `a**`"},
+		{`*a`, "patb: missing argument to repetition operator: `*`"},
+		{`(a`, "patb: missing closing ): `(a`"},
+		{`a)`, "patb: unexpected ): `)`"},
+		{`[a`, "patb: missing closing ]: `[a`"},
+		{`[z-a]`, "patb: invalid character class range: `z-a`"},
+		{`a{2,1}`, "patb: invalid repeat count: `{2,1}`"},
+		{`\q`, "patb: invalid escape sequence: `\\q`"},
+		{`a\`, "patb: trailing backslash at end of expression: `\\`"},
+		{`(?i)a`, "patb: invalid or unsupported Perl syntax: `(?`"},
+		{`[[:foo:]]`, "patb: invalid character class range: `[:foo:]`"},
+	}
+	for _, te := range tests {
+		_, _, err := Compile(te.expr)
+		if err == nil || err.Error() != te.want {
+			t.Errorf("Compile(`%s`) errored %v, want %s", te.expr, err, te.want)
+		}
+	}
+}
+
+func TestClassOf(t *testing.T) {
+	exprs := []string{
+		`[a-zA-Z0-9_.-]`,
+		`[^a-c\d]`,
+		`[\x{3041}-\x{3096}ー]`,
+		`\w`,
+		`\S`,
+		`[[:alnum:]]`,
+		`[[:alpha:][:digit:]]`,
+		`[[:ascii:]]`,
+		`[[:blank:]]`,
+		`[[:cntrl:]]`,
+		`[[:graph:]]`,
+		`[[:lower:]]`,
+		`[[:print:]]`,
+		`[[:punct:]]`,
+		`[[:space:]]`,
+		`[[:upper:]]`,
+		`[[:word:]]`,
+		`[[:xdigit:]]`,
+		`[^[:^lower:]]`,
+		`[[:^space:]]`,
+	}
+	runes := []rune("あいうーア漢é\u0080\u00A0\u3000\U0010FFFF")
+	for r := rune(0); r < 0x80; r++ {
+		runes = append(runes, r)
+	}
+	for _, expr := range exprs {
+		c, err := ClassOf(expr)
+		if err != nil {
+			t.Errorf("ClassOf(`%s`) errored %v", expr, err)
+			continue
+		}
+		re := regexp.MustCompile(`^` + expr + `$`)
+		for _, r := range runes {
+			if got, want := c(r), re.MatchString(string(r)); got != want {
+				t.Errorf("ClassOf(`%s`) (%q) = %t, want %t", expr, r, got, want)
+			}
+		}
+	}
+
+	errors := []struct {
+		expr string
+		want string
+	}{
+		{``, "patb: missing character class: ``"},
+		{`abc`, "patb: missing character class: `abc`"},
+		{`\t`, "patb: missing character class: `\\t`"},
+		{`[a-z]+`, "patb: unexpected trailing characters: `+`"},
+		{`[a-z`, "patb: missing closing ]: `[a-z`"},
+	}
+	for _, te := range errors {
+		_, err := ClassOf(te.expr)
+		if err == nil || err.Error() != te.want {
+			t.Errorf("ClassOf(`%s`) errored %v, want %s", te.expr, err, te.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package patb
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Expand は template のサブマッチの参照を src の範囲 match で置き換えて w に書き込みます.
+//
+// match は FindSubmatchIndex の戻り値です. template の書式は regexp.Regexp.Expand と同じです.
+// $1, ${1} は 1 番目のサブマッチ, $name, ${name} は名前が name のサブマッチ, $0 はパターンに一致した文字列です.
+// $name の name は文字, 数字, _ のできるだけ長い並びなので, $1x は ${1}x ではなく ${1x} と同じです.
+// 範囲外の番号, 存在しない名前, マッチしなかったサブマッチは空文字列に置き換えます.
+// $ を書き込むには $$ と記述します.
+//
+//	// "user=0312341234"
+//	m := FindSubmatchIndex(nil, pat, s, 0)
+//	Expand(w, pat, "user=${user}", s, m)
+func Expand(w Writer, pat Pattern, template, src string, match []int) {
+	expand(w, nodeOf(pat).names, template, src, match)
+}
+
+// expand はサブマッチの名前が names のときの Expand です.
+func expand(w Writer, names []string, template, src string, match []int) {
+	for {
+		k := strings.IndexByte(template, '$')
+		if k < 0 {
+			break
+		}
+		w.WriteString(template[:k])
+		template = template[k+1:]
+		if template != "" && template[0] == '$' {
+			w.WriteByte('$')
+			template = template[1:]
+			continue
+		}
+		name, num, rest, ok := extract(template)
+		if !ok {
+			// 参照の書式でない $ はそのまま書き込みます.
+			w.WriteByte('$')
+			continue
+		}
+		template = rest
+		if num < 0 {
+			for k, s := range names {
+				if s == name {
+					num = k + 1
+					break
+				}
+			}
+		}
+		if num >= 0 && 2*num+1 < len(match) && match[2*num] >= 0 {
+			w.WriteString(src[match[2*num]:match[2*num+1]])
+		}
+	}
+	w.WriteString(template)
+}
+
+// extract は template の先頭のサブマッチの参照 name, {name} を解析します.
+//
+// name が 10 進数なら num にその番号を, そうでなければ -1 を返します.
+// 参照の書式でなければ ok に false を返します.
+func extract(template string) (name string, num int, rest string, ok bool) {
+	brace := template != "" && template[0] == '{'
+	s := template
+	if brace {
+		s = s[1:]
+	}
+	i := 0
+	for i < len(s) {
+		r, w := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		i += w
+	}
+	if i == 0 {
+		return "", 0, "", false
+	}
+	name = s[:i]
+	if brace {
+		if i >= len(s) || s[i] != '}' {
+			return "", 0, "", false
+		}
+		i++
+	}
+	num = 0
+	for k := 0; k < len(name); k++ {
+		if name[k] < '0' || name[k] > '9' || num >= 1e8 {
+			num = -1
+			break
+		}
+		num = num*10 + int(name[k]-'0')
+	}
+	if name[0] == '0' && len(name) > 1 {
+		// 0 で始まる番号は名前として扱います.
+		num = -1
+	}
+	return name, num, s[i:], true
+}
+
+// ReplaceAllTemplate は src の pat に一致する部分をすべて template を展開した文字列に置き換えます.
+//
+// template の $1, ${name} などの参照は Expand と同じく一致した部分のサブマッチに置き換えます.
+//
+//	// `<sip:***@10.0.0.1>`
+//	ReplaceAllTemplate(nil, Block(S("<sip:"), Ch(1, 32, Not("@")), S("@"), NamedCapture("host", Ch(1, 32, Not(">")))),
+//		"<sip:0312341234@10.0.0.1>", "<sip:***@${host}")
+func ReplaceAllTemplate(c CharClass, pat Pattern, src, template string) string {
+	n := nodeOf(pat)
+	w := bytes.NewBuffer(make([]byte, 0, len(src)))
+	i := 0
+	fd := finderOf(c, pat)
+	fd.all(src, false, func(f, l int) bool {
+		w.WriteString(src[i:f])
+		expand(w, n.names, template, src, submatchIndex(n, src, f, l))
+		i = l
+		return true
+	})
+	w.WriteString(src[i:])
+	return w.String()
+}
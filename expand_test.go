@@ -0,0 +1,41 @@
+package patb
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	expr := `<sip:(?P<user>[^@>]+)@(?P<host>[^>:]+)(:(?P<port>\d+))?>`
+	pat, c := MustCompile(expr)
+	re := regexp.MustCompile(expr)
+	src := `"a"<sip:0312341234@10.0.0.1:5060>;<sip:whois@this>`
+	templates := []string{
+		"$0",
+		"<sip:***@${host}>",
+		"$user/$2/${4}",
+		"$1x ${1}x $10 $01 $$1 $ ${ ${user $-",
+		"[$port]",
+		"$unknown${9}",
+		"あ${host}い",
+		"",
+	}
+	for _, template := range templates {
+		want := re.ReplaceAllString(src, template)
+		if got := ReplaceAllTemplate(c, pat, src, template); got != want {
+			t.Errorf("ReplaceAllTemplate(%q) = %q, want %q", template, got, want)
+		}
+
+		var w bytes.Buffer
+		m := FindSubmatchIndex(c, pat, src, 0)
+		Expand(&w, pat, template, src, m)
+		if want := re.ExpandString(nil, template, src, re.FindStringSubmatchIndex(src)); w.String() != string(want) {
+			t.Errorf("Expand(%q) = %q, want %q", template, w.String(), want)
+		}
+	}
+
+	if got, want := ReplaceAllTemplate(nil, Ch(0, 2, Digit()), "a123", "<$0>"), "<>a<12><3>"; got != want {
+		t.Errorf("ReplaceAllTemplate(empty) = %q, want %q", got, want)
+	}
+}
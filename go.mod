@@ -1,3 +1,5 @@
 module github.com/17e10/go-patb
 
-go 1.20
+go 1.24
+
+require golang.org/x/text v0.22.0
@@ -0,0 +1,175 @@
+package patb
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Ahead は指定した Pattern が続く位置にマッチする Pattern を返します.
+//
+// 正規表現の (?=...) と同等です. Ahead は文字を消費せず, 空文字列とマッチします.
+//
+//	// `\d{1,16}(?=@)`
+//	Block(Ch(1, 16, Digit()), Ahead(S("@")))
+func Ahead(pats ...Pattern) Pattern {
+	return lookahead(opAhead, pats)
+}
+
+// NotAhead は指定した Pattern が続かない位置にマッチする Pattern を返します.
+//
+// 正規表現の (?!...) と同等です. NotAhead は文字を消費せず, 空文字列とマッチします.
+//
+//	// @ が続かない数字の並び
+//	Block(Ch(1, 16, Digit()), NotAhead(S("@")))
+func NotAhead(pats ...Pattern) Pattern {
+	return lookahead(opNotAhead, pats)
+}
+
+// lookahead は Ahead, NotAhead の Pattern を返します.
+func lookahead(op op, pats []Pattern) Pattern {
+	sub := block(pats)
+	nd := &node{op: op, subs: []*node{sub}, names: sub.names}
+	not := op == opNotAhead
+	return nd.pattern(func(s string, i int) int {
+		if i > len(s) || (nd.subs[0].pat(s, i) >= 0) == not {
+			return -1
+		}
+		return i
+	})
+}
+
+// Behind は直前の文字列が指定した Pattern にマッチする位置にマッチする Pattern を返します.
+//
+// 正規表現の (?<=...) と同等です. Behind は文字を消費せず, 空文字列とマッチします.
+// 指定した Pattern は現在の位置で終わる s[:i] で評価するので, Tail は現在の位置とマッチします.
+// Scanner は直前の 1 文字だけを保持するので, それより前の文字を正しく評価できません.
+//
+// 指定した Pattern にマッチする文字列の長さに上限がないときは, 直前の 256 バイトまでを評価します.
+// それより前から始まる文字列を評価するには, Ch(1, 1024, Letter()) のように上限を指定します.
+//
+//	// `(?<=<)sip:`
+//	Block(Behind(S("<")), S("sip:"))
+func Behind(pats ...Pattern) Pattern {
+	return lookbehind(opBehind, pats)
+}
+
+// NotBehind は直前の文字列が指定した Pattern にマッチしない位置にマッチする Pattern を返します.
+//
+// 正規表現の (?<!...) と同等です. その他は Behind と同じです.
+// 指定した Pattern にマッチする文字列の長さに上限がないときは, Behind と同じく直前の 256 バイトまでを評価します.
+//
+//	// s が前にない sip:
+//	Block(NotBehind(S("s")), S("sip:"))
+func NotBehind(pats ...Pattern) Pattern {
+	return lookbehind(opNotBehind, pats)
+}
+
+// lookbehind は Behind, NotBehind の Pattern を返します.
+func lookbehind(op op, pats []Pattern) Pattern {
+	sub := block(pats)
+	nd := &node{op: op, max: maxBehind, subs: []*node{sub}, names: sub.names}
+	if lit, rest := splitLiteral(sub); lit != "" && len(rest) == 0 {
+		nd.str = lit
+	}
+	if w, ok := sub.span(); ok {
+		nd.max = uint(w)
+	}
+	not := op == opNotBehind
+	return nd.pattern(func(s string, i int) int {
+		if i > len(s) || (nd.behind(s, i) >= 0) == not {
+			return -1
+		}
+		return i
+	})
+}
+
+// maxBehind は長さの上限がない Behind, NotBehind が遡る最大のバイト数です.
+//
+// 遡る長さを制限して, 検索にかかる時間を文字列の長さに比例させます.
+const maxBehind = 256
+
+// behind は s[:i] の終わりまで n.subs[0] にマッチする範囲の開始位置を返します.
+//
+// i に近い位置から順に試し, マッチしなければ -1 を返します.
+// 最大のバイト数 n.max より前の位置は試しません.
+func (n *node) behind(s string, i int) int {
+	t := s[:i]
+	if n.str != "" {
+		if strings.HasSuffix(t, n.str) {
+			return i - len(n.str)
+		}
+		return -1
+	}
+	lo := 0
+	if n.max < uint(i) {
+		lo = i - int(n.max)
+	}
+	pat := n.subs[0].pat
+	for j := i; j >= lo; j-- {
+		if (j == i || utf8.RuneStart(t[j])) && pat(t, j) == i {
+			return j
+		}
+	}
+	return -1
+}
+
+// maxSpan は span で求める最大のバイト数の上限です.
+const maxSpan = 1 << 20
+
+// span は n にマッチする文字列の最大のバイト数を返します.
+//
+// 上限がないときや maxSpan を超えるときは ok に false を返します.
+func (n *node) span() (w int, ok bool) {
+	switch n.op {
+	case opDot:
+		return utf8.UTFMax, true
+	case opChar:
+		if n.max > maxSpan/utf8.UTFMax {
+			return 0, false
+		}
+		return int(n.max) * utf8.UTFMax, true
+	case opLiteral:
+		if n.fold {
+			// 大文字小文字を区別しないとバイト数が変わることがあります.
+			return utf8.RuneCountInString(n.str) * utf8.UTFMax, true
+		}
+		return len(n.str), true
+	case opHead, opTail, opLineStart, opLineEnd, opWordBoundary, opNotWordBoundary,
+		opAhead, opNotAhead, opBehind, opNotBehind:
+		return 0, true
+	case opBlock:
+		for _, sub := range n.subs {
+			v, ok := sub.span()
+			if !ok || w+v > maxSpan {
+				return 0, false
+			}
+			w += v
+		}
+		return w, true
+	case opRepeat:
+		v, ok := n.subs[0].span()
+		switch {
+		case !ok:
+			return 0, false
+		case v == 0:
+			return 0, true
+		case n.max > uint(maxSpan/v):
+			return 0, false
+		}
+		return v * int(n.max), true
+	case opAny:
+		for _, sub := range n.subs {
+			v, ok := sub.span()
+			if !ok {
+				return 0, false
+			}
+			if v > w {
+				w = v
+			}
+		}
+		return w, true
+	case opCapture, opBacktrack:
+		return n.subs[0].span()
+	}
+	return 0, false
+}
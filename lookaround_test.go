@@ -0,0 +1,59 @@
+package patb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLookaround(t *testing.T) {
+	digits := Ch(1, 16, Digit())
+	tests := []struct {
+		name string
+		pat  Pattern
+		s    string
+		want [][2]int
+	}{
+		{`\d+(?=@)`, Block(digits, Ahead(S("@"))), "tel:123@x 456", [][2]int{{4, 7}}},
+		{`\d+(?!@)`, Block(digits, NotAhead(S("@"))), "123@x 456", [][2]int{{6, 9}}},
+		{`(?<=<)sip:`, Block(Behind(S("<")), S("sip:")), "sip:a <sip:b", [][2]int{{7, 11}}},
+		{`(?<!s)sip:`, Block(NotBehind(S("s")), S("sip:")), "sip:a ssip:b xsip:c", [][2]int{{0, 4}, {14, 18}}},
+		{`(?<=\d\d)[a-z]+`, Block(Behind(Ch(2, 2, Digit())), Ch(1, 8, Lower())), "1abc 12def", [][2]int{{7, 10}}},
+		{`(?<=^a)b`, Block(Behind(Head(), S("a")), S("b")), "abab", [][2]int{{1, 2}}},
+		{`(?<=a$)`, Behind(S("a"), Tail()), "aba", [][2]int{{1, 1}, {3, 3}}},
+		{`(?<=\pL+)\d`, Block(Behind(Ch(1, 256, Letter())), Ch(1, 1, Digit())), "1あ2い3", [][2]int{{4, 5}, {8, 9}}},
+		{`(?<!\d)\d`, Block(NotBehind(Ch(1, 1, Digit())), Ch(1, 1, Digit())), "12a3", [][2]int{{0, 1}, {3, 4}}},
+		{`(?<=\pL+=)\d+`, Block(Behind(Many1(Letter()), S("=")), Many1(Digit())), "key=1 x=22 =3", [][2]int{{4, 5}, {8, 10}}},
+		{`(?<!\pL+)\d`, Block(NotBehind(Many1(Letter())), Ch(1, 1, Digit())), "a1 2", [][2]int{{3, 4}}},
+		{`(?<=^\d*)x`, Block(Behind(Head(), Many(Digit())), S("x")), "123x", [][2]int{{3, 4}}},
+		{`(?<=^\d*)x`, Block(Behind(Head(), Many(Digit())), S("x")), strings.Repeat("1", 300) + "x", nil},
+		{`(?<=\pL+=)\d+`, Block(Behind(Many1(Letter()), S("=")), Many1(Digit())), strings.Repeat("1", 32000), nil},
+	}
+	for _, te := range tests {
+		for _, pat := range []Pattern{te.pat, Optimize(te.pat)} {
+			if got := FindAllIndex(nil, pat, te.s, -1); !reflect.DeepEqual(got, te.want) {
+				t.Errorf("FindAllIndex(`%s`, %q) = %v, want %v", te.name, te.s, got, te.want)
+			}
+		}
+	}
+}
+
+func TestLookaroundSubmatch(t *testing.T) {
+	tests := []struct {
+		name string
+		pat  Pattern
+		s    string
+		want []int
+	}{
+		{`a(?=(b))`, Block(S("a"), Ahead(Capture(S("b")))), "ab", []int{0, 1, 1, 2}},
+		{`(?<=(\d+))x`, Block(Behind(Capture(Ch(1, 3, Digit()))), S("x")), "12x", []int{2, 3, 1, 2}},
+		{`(?!(x))(.)`, Block(NotAhead(Capture(S("x"))), Capture(Dot())), "a", []int{0, 1, -1, -1, 0, 1}},
+		{`.*(?=(b))b`, Backtrack(Ch(0, 8, All()), Ahead(Capture(S("b"))), S("b")), "abab", []int{0, 4, 3, 4}},
+		{`.*(?<=(a))b`, Backtrack(Ch(0, 8, All()), Behind(Capture(S("a"))), S("b")), "abab", []int{0, 4, 2, 3}},
+	}
+	for _, te := range tests {
+		if got := FindSubmatchIndex(nil, te.pat, te.s, 0); !reflect.DeepEqual(got, te.want) {
+			t.Errorf("FindSubmatchIndex(`%s`, %q) = %v, want %v", te.name, te.s, got, te.want)
+		}
+	}
+}
@@ -0,0 +1,522 @@
+package patb
+
+import (
+	"runtime"
+	"sync"
+	"unicode/utf8"
+	"weak"
+)
+
+// op は node の種類を表します.
+type op uint8
+
+const (
+	opFunc            op = iota // 構造を持たない Pattern
+	opDot                       // Dot
+	opChar                      // Ch
+	opLiteral                   // S, SFold
+	opHead                      // Head
+	opTail                      // Tail
+	opLineStart                 // LineStart
+	opLineEnd                   // LineEnd
+	opWordBoundary              // WordBoundary, UnicodeWordBoundary
+	opNotWordBoundary           // NotWordBoundary, NotUnicodeWordBoundary
+	opBlock                     // Block
+	opRepeat                    // Repeat
+	opAny                       // Any
+	opCapture                   // Capture, NamedCapture
+	opBacktrack                 // Backtrack
+	opAhead                     // Ahead
+	opNotAhead                  // NotAhead
+	opBehind                    // Behind
+	opNotBehind                 // NotBehind
+	opRef                       // Ref
+)
+
+// node は Pattern の構造を表します.
+//
+// Pattern は関数なので自身の構造を持てません.
+// patb が作る Pattern は node を持ち, nodeOf で取り出せるようにしています.
+// node はサブマッチのように Pattern の構造を必要とする機能で使用します.
+type node struct {
+	op       op
+	pat      Pattern   // 構造を使わずに評価する Pattern
+	min, max uint      // opChar, opRepeat の繰り返し回数, opBehind, opNotBehind の最大のバイト数
+	class    CharClass // opChar のキャラクタクラス, opWordBoundary, opNotWordBoundary の単語の文字
+	str      string    // opLiteral の文字列, opCapture の名前, opBehind, opNotBehind の末尾の文字列
+	fold     bool      // opLiteral で大文字小文字を区別しない
+	lazy     bool      // opChar, opRepeat は少ない回数から試し, opBlock, opCapture はそれを含みます
+	subs     []*node   // 子の node
+	names    []string  // 部分木に含まれるサブマッチの名前 (出現順)
+	ref      *Pattern  // opRef の参照先
+
+	lead     CharClass // leading の結果
+	leadOnce sync.Once
+
+	prefix     string // hoist の結果
+	prefixOnce sync.Once
+
+	skip     func(s string, i int) int // skipper の結果
+	skipOnce sync.Once
+}
+
+// known は patb が作った Pattern の node です.
+//
+// キーは funcKey で, 値は Pattern が捕捉している node の weak.Pointer です.
+// Pattern が解放されると node も解放され, 登録を削除します.
+// 変数を捕捉しない Pattern は解放されないので, static で node をそのまま登録します.
+var known sync.Map
+
+// pattern は n を評価する Pattern として pat を登録します.
+//
+// pat は n を捕捉しなければなりません. 捕捉しなければ n が先に解放されます.
+func (n *node) pattern(pat Pattern) Pattern {
+	n.pat = pat
+	key, w := funcKey(pat), weak.Make(n)
+	known.Store(key, w)
+	runtime.AddCleanup(n, func(key uintptr) {
+		known.CompareAndDelete(key, w)
+	}, key)
+	return pat
+}
+
+// static は n を評価する Pattern として, 変数を捕捉しない pat を登録します.
+func (n *node) static(pat Pattern) Pattern {
+	n.pat = pat
+	known.Store(funcKey(pat), n)
+	return pat
+}
+
+// nodeOf は pat の node を返します.
+//
+// patb が作った Pattern でなければ opFunc の node を返します.
+func nodeOf(pat Pattern) *node {
+	v, _ := known.Load(funcKey(pat))
+	switch v := v.(type) {
+	case *node:
+		return v
+	case weak.Pointer[node]:
+		if n := v.Value(); n != nil {
+			return n
+		}
+	}
+	return &node{op: opFunc, pat: pat}
+}
+
+// nodesOf は pats の node を返します.
+func nodesOf(pats []Pattern) []*node {
+	subs := make([]*node, len(pats))
+	for i, pat := range pats {
+		subs[i] = nodeOf(pat)
+	}
+	return subs
+}
+
+// namesOf は subs に含まれるサブマッチの名前を返します.
+func namesOf(subs []*node) []string {
+	var names []string
+	for _, sub := range subs {
+		names = append(names, sub.names...)
+	}
+	return names
+}
+
+// first は n にマッチする文字列の先頭文字のキャラクタクラスを返します.
+//
+// n が空文字列とマッチし得るときは empty に true を返します.
+// 先頭文字を特定できないときは ok に false を返します.
+func (n *node) first() (classes []CharClass, empty bool, ok bool) {
+	switch n.op {
+	case opDot:
+		return []CharClass{All()}, false, true
+	case opChar:
+		return []CharClass{n.class}, n.min == 0, true
+	case opLiteral:
+		if n.str == "" {
+			return nil, true, true
+		}
+		r, _ := utf8.DecodeRuneInString(n.str)
+		if n.fold {
+			return []CharClass{CFold(string(r))}, false, true
+		}
+		return []CharClass{C(string(r))}, false, true
+	case opHead, opTail, opLineStart, opLineEnd, opWordBoundary, opNotWordBoundary,
+		opAhead, opNotAhead, opBehind, opNotBehind:
+		return nil, true, true
+	case opBlock:
+		for _, sub := range n.subs {
+			c, e, ok := sub.first()
+			if !ok {
+				return nil, false, false
+			}
+			classes = append(classes, c...)
+			if !e {
+				return classes, false, true
+			}
+		}
+		return classes, true, true
+	case opRepeat:
+		classes, empty, ok = n.subs[0].first()
+		return classes, empty || n.min == 0, ok
+	case opAny:
+		for _, sub := range n.subs {
+			c, e, ok := sub.first()
+			if !ok {
+				return nil, false, false
+			}
+			classes, empty = append(classes, c...), empty || e
+		}
+		return classes, empty, true
+	case opCapture, opBacktrack:
+		return n.subs[0].first()
+	}
+	return nil, false, false
+}
+
+// leading は n にマッチする文字列の先頭文字の CharClass を返します.
+//
+// 先頭文字を特定できないときや空文字列とマッチし得るときは All を返します.
+func (n *node) leading() CharClass {
+	n.leadOnce.Do(func() {
+		classes, empty, ok := n.first()
+		if !ok || empty {
+			n.lead = All()
+			return
+		}
+		n.lead = Or(classes...)
+	})
+	return n.lead
+}
+
+// machine はサブマッチを記録しながら node を評価します.
+//
+// caps[2*k], caps[2*k+1] は k 番目のサブマッチの範囲です.
+// caps が nil のときはサブマッチを記録しません.
+type machine struct {
+	caps  []int
+	stack []int
+}
+
+// save は base 以降の n のサブマッチの範囲を退避します.
+func (m *machine) save(n *node, base int) int {
+	mark := len(m.stack)
+	m.stack = append(m.stack, m.caps[2*base+2:2*(base+len(n.names))+2]...)
+	return mark
+}
+
+// restore は save で退避したサブマッチの範囲を戻します.
+func (m *machine) restore(mark int, base int) {
+	copy(m.caps[2*base+2:], m.stack[mark:])
+	m.stack = m.stack[:mark]
+}
+
+// match は s[i:] を n で評価し, サブマッチを記録します.
+//
+// base は n に含まれる最初のサブマッチの番号 - 1 です.
+// 戻り値は n.pat と同じです.
+func (n *node) match(m *machine, s string, i int, base int) int {
+	if len(n.names) == 0 {
+		return n.pat(s, i)
+	}
+	if n.lazy {
+		return n.step(m, s, i, base, accept)
+	}
+	switch n.op {
+	case opBlock:
+		for _, sub := range n.subs {
+			if i = sub.match(m, s, i, base); i < 0 {
+				return -1
+			}
+			base += len(sub.names)
+		}
+		return i
+	case opRepeat:
+		sub := n.subs[0]
+		var cnt uint
+		for ; cnt < n.max; cnt++ {
+			mark := m.save(sub, base)
+			next := sub.match(m, s, i, base)
+			if next < 0 || next == i && !n.empty(cnt) {
+				m.restore(mark, base)
+				break
+			}
+			m.stack = m.stack[:mark]
+			if next == i {
+				cnt = n.max
+				break
+			}
+			i = next
+		}
+		if cnt < n.min {
+			return -1
+		}
+		return i
+	case opAny:
+		for _, sub := range n.subs {
+			mark := m.save(sub, base)
+			if next := sub.match(m, s, i, base); next >= 0 {
+				m.stack = m.stack[:mark]
+				return next
+			}
+			m.restore(mark, base)
+			base += len(sub.names)
+		}
+		return -1
+	case opCapture:
+		next := n.subs[0].match(m, s, i, base+1)
+		if next >= 0 {
+			m.caps[2*base+2], m.caps[2*base+3] = i, next
+		}
+		return next
+	case opBacktrack:
+		return n.subs[0].run(m, s, i, base, accept)
+	case opAhead:
+		if n.subs[0].match(m, s, i, base) < 0 {
+			return -1
+		}
+		return i
+	case opBehind:
+		j := n.behind(s, i)
+		if j < 0 {
+			return -1
+		}
+		n.subs[0].match(m, s[:i], j, base)
+		return i
+	}
+	return n.pat(s, i)
+}
+
+// accept は run の最後の継続です.
+func accept(i int) int {
+	return i
+}
+
+// run は s[i:] を後戻りしながら n で評価します.
+//
+// n とマッチすると, マッチした文字列の次の文字のインデックスを継続 k に渡します.
+// k が -1 を返すと n は別のマッチを試し, すべて失敗すると -1 を返します.
+// k が -1 以外を返すとその値を返します.
+func (n *node) run(m *machine, s string, i int, base int, k func(i int) int) int {
+	switch n.op {
+	case opChar:
+		if n.lazy {
+			return n.charLazy(s, i, k)
+		}
+		j := n.pat(s, i)
+		if j < 0 {
+			return -1
+		}
+		for cnt := uint(utf8.RuneCountInString(s[i:j])); ; cnt-- {
+			if r := k(j); r >= 0 {
+				return r
+			}
+			if cnt <= n.min {
+				return -1
+			}
+			_, w := utf8.DecodeLastRuneInString(s[i:j])
+			j -= w
+		}
+	case opBlock:
+		return n.runBlock(m, s, i, base, 0, k)
+	case opRepeat:
+		sub := n.subs[0]
+		if n.lazy {
+			return n.repeatLazy(i, k, func(i int, k func(j int) int) int {
+				return sub.run(m, s, i, base, k)
+			})
+		}
+		var rep func(i int, cnt uint) int
+		rep = func(i int, cnt uint) int {
+			if cnt < n.max {
+				r := sub.run(m, s, i, base, func(j int) int {
+					switch {
+					case j != i:
+						return rep(j, cnt+1)
+					case n.empty(cnt):
+						// 空文字列の繰り返しはそれ以上繰り返しても同じなので終えます.
+						return k(j)
+					}
+					return -1
+				})
+				if r >= 0 {
+					return r
+				}
+			}
+			if cnt < n.min {
+				return -1
+			}
+			return k(i)
+		}
+		return rep(i, 0)
+	case opAny:
+		for _, sub := range n.subs {
+			if r := sub.run(m, s, i, base, k); r >= 0 {
+				return r
+			}
+			base += len(sub.names)
+		}
+		return -1
+	case opCapture:
+		return n.subs[0].run(m, s, i, base+1, func(j int) int {
+			if m.caps == nil {
+				return k(j)
+			}
+			f, l := m.caps[2*base+2], m.caps[2*base+3]
+			m.caps[2*base+2], m.caps[2*base+3] = i, j
+			if r := k(j); r >= 0 {
+				return r
+			}
+			m.caps[2*base+2], m.caps[2*base+3] = f, l
+			return -1
+		})
+	case opBacktrack:
+		return n.subs[0].run(m, s, i, base, k)
+	case opAhead, opBehind:
+		if m.caps == nil || len(n.names) == 0 {
+			break
+		}
+		// 後続が失敗したら先読み, 後読みで記録したサブマッチを戻します.
+		mark := m.save(n, base)
+		if j := n.match(m, s, i, base); j >= 0 {
+			if r := k(j); r >= 0 {
+				m.stack = m.stack[:mark]
+				return r
+			}
+		}
+		m.restore(mark, base)
+		return -1
+	}
+	j := n.pat(s, i)
+	if j < 0 {
+		return -1
+	}
+	return k(j)
+}
+
+// runBlock は n.subs[x:] を順に後戻りしながら評価します.
+func (n *node) runBlock(m *machine, s string, i int, base int, x int, k func(i int) int) int {
+	if x == len(n.subs) {
+		return k(i)
+	}
+	sub := n.subs[x]
+	return sub.run(m, s, i, base, func(j int) int {
+		return n.runBlock(m, s, j, base+len(sub.names), x+1, k)
+	})
+}
+
+// step は s[i:] を n で評価して, マッチした文字列の次の文字のインデックスを継続 k に渡します.
+//
+// run と異なり, 後戻りするのは ChLazy, RepeatLazy の繰り返しの回数だけです.
+// その他の node は n.pat と同じく後戻りせずに評価します.
+func (n *node) step(m *machine, s string, i int, base int, k func(i int) int) int {
+	switch {
+	case n.op == opChar && n.lazy:
+		return n.charLazy(s, i, k)
+	case n.op == opRepeat && n.lazy:
+		sub := n.subs[0]
+		return n.repeatLazy(i, k, func(i int, k func(j int) int) int {
+			return sub.step(m, s, i, base, k)
+		})
+	case n.op == opBlock && n.lazy:
+		return n.stepBlock(m, s, i, base, 0, k)
+	case n.op == opCapture && n.lazy:
+		return n.subs[0].step(m, s, i, base+1, func(j int) int {
+			if m.caps == nil {
+				return k(j)
+			}
+			f, l := m.caps[2*base+2], m.caps[2*base+3]
+			m.caps[2*base+2], m.caps[2*base+3] = i, j
+			if r := k(j); r >= 0 {
+				return r
+			}
+			m.caps[2*base+2], m.caps[2*base+3] = f, l
+			return -1
+		})
+	case m.caps != nil && len(n.names) > 0:
+		// 後続が失敗したら記録したサブマッチを戻します.
+		mark := m.save(n, base)
+		if j := n.match(m, s, i, base); j >= 0 {
+			if r := k(j); r >= 0 {
+				m.stack = m.stack[:mark]
+				return r
+			}
+		}
+		m.restore(mark, base)
+		return -1
+	}
+	j := n.pat(s, i)
+	if j < 0 {
+		return -1
+	}
+	return k(j)
+}
+
+// stepBlock は n.subs[x:] を順に step で評価します.
+func (n *node) stepBlock(m *machine, s string, i int, base int, x int, k func(i int) int) int {
+	if x == len(n.subs) {
+		return k(i)
+	}
+	sub := n.subs[x]
+	return sub.step(m, s, i, base, func(j int) int {
+		return n.stepBlock(m, s, j, base+len(sub.names), x+1, k)
+	})
+}
+
+// charLazy は ChLazy の n にマッチする文字列を短い順に継続 k に渡します.
+func (n *node) charLazy(s string, i int, k func(i int) int) int {
+	if i > len(s) {
+		return -1
+	}
+	for cnt := uint(0); ; cnt++ {
+		if cnt >= n.min {
+			if r := k(i); r >= 0 {
+				return r
+			}
+		}
+		if cnt >= n.max || i >= len(s) {
+			return -1
+		}
+		r, w := utf8.DecodeRuneInString(s[i:])
+		if !n.class(r) {
+			return -1
+		}
+		i += w
+	}
+}
+
+// repeatLazy は RepeatLazy の n の繰り返しを少ない回数から順に継続 k に渡します.
+//
+// 繰り返しの 1 回分は sub で評価します.
+func (n *node) repeatLazy(i int, k func(i int) int, sub func(i int, k func(j int) int) int) int {
+	var rep func(i int, cnt uint) int
+	rep = func(i int, cnt uint) int {
+		if cnt >= n.min {
+			if r := k(i); r >= 0 {
+				return r
+			}
+		}
+		if cnt >= n.max {
+			return -1
+		}
+		return sub(i, func(j int) int {
+			switch {
+			case j != i:
+				return rep(j, cnt+1)
+			case n.empty(cnt):
+				// 空文字列の繰り返しはそれ以上繰り返しても同じなので終えます.
+				return k(j)
+			}
+			return -1
+		})
+	}
+	return rep(i, 0)
+}
+
+// empty は cnt 回の繰り返しの次の, 空文字列にマッチした繰り返しを認めるかを返します.
+//
+// regexp と同じく, 空文字列の繰り返しは max(min, 1) 回目まで認めてそのサブマッチを記録します.
+// それより後の空文字列の繰り返しは認めず, 繰り返しの中の他の選択肢を試します.
+// max に上限があるときは, regexp が {n,m} を入れ子の ? に展開するのと同じく常に認めます.
+func (n *node) empty(cnt uint) bool {
+	return cnt < n.min || cnt == 0 || n.max != Inf
+}
@@ -0,0 +1,263 @@
+package patb
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Optimize は pat と同じ評価をする, 構造を整理した Pattern を返します.
+//
+// Optimize は pat の構造を次のように書き換えます.
+//
+//	Block(S("a"), Block(S("b"), x))     Block(S("ab"), x)
+//	Any(S("sip"), S("tel"), S("sips"))  文字列を順に比べる専用の Pattern
+//	Repeat(0, 1, S("x"))                S("x") を省略できる専用の Pattern
+//
+// Any の選択肢の順序は変えないので, 後戻りしない評価でも Backtrack の中でも結果は変わりません.
+// patb が作っていない Pattern はそのまま使用します.
+func Optimize(pat Pattern) Pattern {
+	return optimize(nodeOf(pat))
+}
+
+// optimize は n を最適化した Pattern を返します.
+func optimize(n *node) Pattern {
+	switch n.op {
+	case opBlock:
+		pats := optimizeBlock(n.subs)
+		if len(pats) == 1 {
+			return pats[0]
+		}
+		return Block(pats...)
+	case opRepeat:
+		pats := optimizeBlock(n.subs[0].subs)
+		if n.lazy {
+			return RepeatLazy(n.min, n.max, pats...)
+		}
+		if n.min == 0 && n.max == 1 && len(pats) == 1 {
+			if sub := nodeOf(pats[0]); sub.op == opLiteral && !sub.fold {
+				return optional(sub.str)
+			}
+		}
+		return Repeat(n.min, n.max, pats...)
+	case opAny:
+		pats := optimizeAny(n.subs)
+		if len(pats) == 1 {
+			return pats[0]
+		}
+		return Any(pats...)
+	case opCapture:
+		return NamedCapture(n.str, optimizeBlock(n.subs[0].subs)...)
+	case opBacktrack:
+		return Backtrack(optimizeBlock(n.subs[0].subs)...)
+	case opAhead, opNotAhead:
+		return lookahead(n.op, optimizeBlock(n.subs[0].subs))
+	case opBehind, opNotBehind:
+		return lookbehind(n.op, optimizeBlock(n.subs[0].subs))
+	}
+	return n.pat
+}
+
+// optimizeBlock は Block の subs を最適化した Pattern を返します.
+//
+// 入れ子の Block を展開し, 連続する S, SFold をひとつにまとめます.
+func optimizeBlock(subs []*node) []Pattern {
+	var pats []Pattern
+	var lit strings.Builder
+	fold := false
+	flush := func() {
+		if lit.Len() > 0 {
+			if fold {
+				pats = append(pats, SFold(lit.String()))
+			} else {
+				pats = append(pats, S(lit.String()))
+			}
+			lit.Reset()
+		}
+	}
+	for _, sub := range flatten(nil, subs, opBlock) {
+		sub = nodeOf(optimize(sub))
+		if sub.op != opLiteral {
+			flush()
+			pats = append(pats, sub.pat)
+			continue
+		}
+		if sub.fold != fold {
+			flush()
+			fold = sub.fold
+		}
+		lit.WriteString(sub.str)
+	}
+	flush()
+	if len(pats) == 0 {
+		pats = append(pats, S(""))
+	}
+	return pats
+}
+
+// optimizeAny は Any の subs を最適化した Pattern を返します.
+//
+// 連続する S の選択肢を, 文字列を順に比べる専用の Pattern にまとめます.
+// 選択肢の順序は変えないので, 後戻りしない評価でも Backtrack の中でも結果は変わりません.
+func optimizeAny(subs []*node) []Pattern {
+	var pats []Pattern
+	var lits []string
+	flush := func() {
+		switch len(lits) {
+		case 0:
+		case 1:
+			pats = append(pats, S(lits[0]))
+		default:
+			pats = append(pats, literals(lits))
+		}
+		lits = nil
+	}
+	for _, sub := range flatten(nil, subs, opAny) {
+		sub = nodeOf(optimize(sub))
+		if sub.op != opLiteral || sub.fold {
+			flush()
+			pats = append(pats, sub.pat)
+			continue
+		}
+		lits = append(lits, sub.str)
+	}
+	flush()
+	return pats
+}
+
+// literals は Any(S(lits[0]), S(lits[1]), ...) と同じ評価をする Pattern を返します.
+//
+// 選択肢ごとに Pattern を呼び出さず, 先頭のバイトが異なる文字列は比べずに飛ばします.
+func literals(lits []string) Pattern {
+	pats := make([]Pattern, len(lits))
+	for i, lit := range lits {
+		pats[i] = S(lit)
+	}
+	nd := &node{op: opAny, subs: nodesOf(pats)}
+	return nd.pattern(func(s string, i int) int {
+		if i > len(s) {
+			return -1
+		}
+		rest := s[i:]
+		for _, sub := range nd.subs {
+			lit := sub.str
+			if lit == "" {
+				return i
+			}
+			if len(lit) <= len(rest) && lit[0] == rest[0] && rest[:len(lit)] == lit {
+				return i + len(lit)
+			}
+		}
+		return -1
+	})
+}
+
+// flatten は subs のうち op の node を展開して v に追加します.
+func flatten(v []*node, subs []*node, op op) []*node {
+	for _, sub := range subs {
+		if sub.op == op {
+			v = flatten(v, sub.subs, op)
+		} else {
+			v = append(v, sub)
+		}
+	}
+	return v
+}
+
+// splitLiteral は n の先頭の文字列と残りの node を返します.
+//
+// n の先頭が S でなければ "" を返します.
+func splitLiteral(n *node) (lit string, rest []*node) {
+	switch {
+	case n.op == opLiteral && !n.fold:
+		return n.str, nil
+	case n.op == opBlock && len(n.subs) > 0 && n.subs[0].op == opLiteral && !n.subs[0].fold:
+		return n.subs[0].str, n.subs[1:]
+	}
+	return "", nil
+}
+
+// optional は Repeat(0, 1, S(lit)) と同じ評価をする Pattern を返します.
+func optional(lit string) Pattern {
+	sub := block([]Pattern{S(lit)})
+	nd := &node{op: opRepeat, min: 0, max: 1, subs: []*node{sub}}
+	return nd.pattern(func(s string, i int) int {
+		lit := nd.subs[0].subs[0].str
+		w := len(lit)
+		if i+w <= len(s) && s[i:i+w] == lit {
+			return i + w
+		}
+		return i
+	})
+}
+
+// literal は n にマッチする文字列が必ず始まる文字列を返します.
+//
+// n が prefix だけにマッチするときは complete に true を返します.
+func (n *node) literal() (prefix string, complete bool) {
+	switch n.op {
+	case opLiteral:
+		if n.fold {
+			return "", false
+		}
+		return n.str, true
+	case opChar:
+		cs := setOf(n.class)
+		v := cs.all()
+		if cs.rest != nil || len(v) != 1 || v[0].lo != v[0].hi || v[0].lo == utf8.RuneError || n.min == 0 || n.min > 256 {
+			return "", false
+		}
+		return strings.Repeat(string(v[0].lo), int(n.min)), n.min == n.max
+	case opHead, opTail, opLineStart, opLineEnd, opWordBoundary, opNotWordBoundary,
+		opAhead, opNotAhead, opBehind, opNotBehind:
+		return "", true
+	case opBlock:
+		var b strings.Builder
+		for _, sub := range n.subs {
+			p, c := sub.literal()
+			b.WriteString(p)
+			if !c {
+				return b.String(), false
+			}
+		}
+		return b.String(), true
+	case opRepeat:
+		if n.min == 0 || n.min > 256 {
+			return "", false
+		}
+		p, c := n.subs[0].literal()
+		if !c {
+			return p, false
+		}
+		return strings.Repeat(p, int(n.min)), n.min == n.max
+	case opAny:
+		if len(n.subs) == 0 {
+			return "", false
+		}
+		prefix, complete := n.subs[0].literal()
+		for _, sub := range n.subs[1:] {
+			p, c := sub.literal()
+			complete = complete && c && p == prefix
+			i := 0
+			for i < len(prefix) && i < len(p) && prefix[i] == p[i] {
+				i++
+			}
+			prefix = prefix[:i]
+		}
+		return prefix, complete
+	case opCapture, opBacktrack:
+		return n.subs[0].literal()
+	}
+	return "", false
+}
+
+// hoist は n にマッチする文字列の先頭の, strings.Index で検索できる文字列を返します.
+func (n *node) hoist() string {
+	n.prefixOnce.Do(func() {
+		p, _ := n.literal()
+		for len(p) > 0 && !utf8.ValidString(p) {
+			p = p[:len(p)-1]
+		}
+		n.prefix = p
+	})
+	return n.prefix
+}
@@ -0,0 +1,114 @@
+package patb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		pat  Pattern
+		want string
+	}{
+		{Block(S("a"), Block(S("b"), Ch(1, 2, Digit())), S("c"), S("d")), `ab[0-9]{1,2}cd`},
+		{Block(SFold("a"), SFold("b"), S("c")), `(?i:ab)c`},
+		{Block(S(""), Block()), ``},
+		{Any(S("sip"), S("tel"), S("sips")), `sip|tel|sips`},
+		{Any(S("abc"), S("abd"), Ch(1, 1, Digit()), S("ab")), `(?:abc|abd)|[0-9]|ab`},
+		{Any(Block(S("ab"), Ch(1, 1, Digit())), Any(S("ac"), S("b"))), `ab[0-9]|(?:ac|b)`},
+		{Any(Capture(S("a")), Block(S("b"), Capture(S("c"))), S("ax")), `(a)|b(c)|ax`},
+		{Repeat(0, 1, S("x")), `x?`},
+		{Repeat(0, 1, S("x"), S("y")), `(?:xy)?`},
+		{Backtrack(Repeat(0, 1, Block(S("x"))), S("x")), `x?x`},
+	}
+	for _, te := range tests {
+		if got := Optimize(te.pat).String(); got != te.want {
+			t.Errorf("Optimize(`%s`) = `%s`, want `%s`", te.pat, got, te.want)
+		}
+	}
+}
+
+func TestOptimizeEqual(t *testing.T) {
+	pats := []Pattern{
+		Any(S("sip"), S("tel"), S("sips")),
+		Block(S("<"), Any(S("sip"), S("tel"), S("sips")), S(":")),
+		Backtrack(S("<"), Any(S("sip"), S("tel"), S("sips")), S(":")),
+		Backtrack(Any(S("ab"), Capture(S("a")), S("abc")), Repeat(0, 1, S("c")), Tail()),
+		Block(Repeat(0, 1, S(`"`)), Ch(0, 8, Not(`"`)), Repeat(0, 1, S(`"`))),
+		Backtrack(Any(Block(S("a"), Capture(Ch(0, 4, Word()))), S("ab")), S("!")),
+		Backtrack(Any(S("a"), S(""), S("ab")), S("b"), Tail()),
+		Any(S("\xff"), S("abcd"), S("ab"), SFold("SIP"), S("sip")),
+	}
+	texts := []string{"", "<sip:", "<sips:", "<tel:", "abc", "abcc", "a", `"abc"`, "ab!", "abcd!", "sipsip"}
+	for _, pat := range pats {
+		opt := Optimize(pat)
+		for _, s := range texts {
+			for i := 0; i <= len(s); i++ {
+				if got, want := opt(s, i), pat(s, i); got != want {
+					t.Errorf("Optimize(`%s`) (%q, %d) = %d, want %d", pat, s, i, got, want)
+				}
+			}
+			if got, want := FindSubmatchIndex(nil, opt, s, 0), FindSubmatchIndex(nil, pat, s, 0); !reflect.DeepEqual(got, want) {
+				t.Errorf("FindSubmatchIndex(Optimize(`%s`), %q) = %v, want %v", pat, s, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkOptimize(b *testing.B) {
+	var pats []Pattern
+	for _, w := range []string{"ERROR", "WARN", "FATAL", "panic:", "timeout", "refused", "sips:", "tel:", "mailto:", "https://"} {
+		pats = append(pats, S(w))
+	}
+	pat := Any(pats...)
+	texts := []string{"https://example.com", "sip:x@y", "ERROR x"}
+
+	b.Run("pat", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for _, s := range texts {
+				pat(s, 0)
+			}
+		}
+	})
+	b.Run("optimize", func(b *testing.B) {
+		opt := Optimize(pat)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			for _, s := range texts {
+				opt(s, 0)
+			}
+		}
+	})
+}
+
+func TestHoist(t *testing.T) {
+	tests := []struct {
+		pat  Pattern
+		want string
+	}{
+		{S("abc"), "abc"},
+		{SFold("abc"), ""},
+		{Block(Head(), S("sip"), S(":"), Ch(1, 8, Digit())), "sip:"},
+		{Block(Ch(2, 2, C("<")), Ch(1, 3, C("a")), S("b")), "<<a"},
+		{Any(S("sips"), Block(S("sip"), S(":"))), "sip"},
+		{Capture(Repeat(2, 2, S("ab")), S("c")), "ababc"},
+		{Block(Repeat(0, 1, S("a")), S("b")), ""},
+		{S("あい\xe3\x81"), "あい"},
+	}
+	for _, te := range tests {
+		if got := nodeOf(te.pat).hoist(); got != te.want {
+			t.Errorf("hoist(`%s`) = %q, want %q", te.pat, got, te.want)
+		}
+	}
+
+	pat := Block(S("sip:"), Ch(1, 32, Not("@>")), S("@"))
+	s := `<sip:0312341234@10.0.0.1>;sip:>;sip:x@y`
+	var got []string
+	FindAllFunc(nil, pat, s, func(m string) error {
+		got = append(got, m)
+		return nil
+	})
+	if want := []string{"sip:0312341234@", "sip:x@"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllFunc(nil, `%s`) = %q, want %q", pat, got, want)
+	}
+}
@@ -14,4 +14,7 @@
 // マッチする文字列の先頭文字を表すキャラクタクラス c を指定します.
 // すべての文字を表す pat.All を指定することで c の定義を省略できます.
 // 検索速度は遅くなりますが手軽に利用することができます.
+//
+// c に nil を指定すると, pat から求めた先頭文字のキャラクタクラス First(pat) を使用します.
+// 先頭文字を特定できない Pattern では All と同じ速度になります.
 package patb
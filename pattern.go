@@ -1,6 +1,7 @@
 package patb
 
 import (
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -13,95 +14,256 @@ type Pattern func(s string, i int) int
 
 // Dot は任意の 1 文字にマッチする Pattern です.
 func Dot() Pattern {
-	return func(s string, i int) int {
-		if i > len(s) {
-			return -1
-		}
-		_, w := utf8.DecodeRuneInString(s[i:])
-		return i + w
-	}
+	return dot
 }
 
+// dot は Dot が返す Pattern です.
+var dot = (&node{op: opDot}).static(func(s string, i int) int {
+	if i > len(s) {
+		return -1
+	}
+	_, w := utf8.DecodeRuneInString(s[i:])
+	return i + w
+})
+
+// Inf は Ch, Repeat などの max に指定する上限のない繰り返しの回数です.
+const Inf = ^uint(0)
+
 // Ch はキャラクタクラスにマッチする Pattern を返します.
 //
-// min, max の文字数の文字列にマッチします.
+// min, max の文字数の文字列にマッチします. max に Inf を指定すると上限なくマッチします.
 // キャラクタクラスは複数指定できます.
+//
+// Ch は max までできるだけ長くマッチし, 後続の Pattern のために文字を戻しません.
+// 文字を戻す必要があるときは Backtrack を, できるだけ短くマッチするときは ChLazy を使用します.
 func Ch(min, max uint, classes ...CharClass) Pattern {
-	var c CharClass
-	switch len(classes) {
-	case 0:
-		c = func(r rune) bool {
-			return false
-		}
-	case 1:
-		c = classes[0]
-	default:
-		c = func(r rune) bool {
-			for _, c := range classes {
-				if c(r) {
-					return true
-				}
-			}
-			return false
-		}
-	}
-
-	return func(s string, i int) int {
+	nd := &node{op: opChar, min: min, max: max, class: Or(classes...)}
+	return nd.pattern(func(s string, i int) int {
 		if i > len(s) {
 			return -1
 		}
-		s = s[i:]
-		n := uint(0)
-		for _, r := range s {
+		c, n := nd.class, uint(0)
+		for n < max && i < len(s) {
+			r, w := utf8.DecodeRuneInString(s[i:])
 			if !c(r) {
 				break
 			}
-			i, n = i+utf8.RuneLen(r), n+1
-			if n >= max {
-				break
-			}
+			i, n = i+w, n+1
 		}
 		if n < min {
 			return -1
 		}
 		return i
-	}
+	})
+}
+
+// ChLazy は Ch と同じキャラクタクラスの min, max の文字数の文字列に, できるだけ短くマッチする Pattern を返します.
+//
+// ChLazy は Block, Backtrack の中で後続の Pattern がマッチするまで 1 文字ずつ長くします.
+// 正規表現の *?, +?, {n,m}? に相当します.
+//
+//	// `"[^\n]*?"`
+//	Block(S(`"`), ChLazy(0, 256, Not("\n")), S(`"`))
+func ChLazy(min, max uint, classes ...CharClass) Pattern {
+	nd := &node{op: opChar, min: min, max: max, class: Or(classes...), lazy: true}
+	return nd.pattern(func(s string, i int) int {
+		return nd.charLazy(s, i, accept)
+	})
 }
 
 // S は指定文字列にマッチする Pattern を返します.
 func S(substr string) Pattern {
-	w := len(substr)
-	return func(s string, i int) int {
-		if i+w > len(s) || s[i:i+w] != substr {
+	nd := &node{op: opLiteral, str: substr}
+	return nd.pattern(func(s string, i int) int {
+		w := len(nd.str)
+		if i+w > len(s) || s[i:i+w] != nd.str {
 			return -1
 		}
 		return i + w
-	}
+	})
 }
 
-// Head は先頭を表す Pattern を返します.
-func Head() Pattern {
-	return func(s string, i int) int {
-		if i > 0 {
+// SFold は大文字小文字を区別せずに指定文字列にマッチする Pattern を返します.
+//
+// Unicode の単純大文字小文字畳み込み (strings.EqualFold と同じ規則) で比較します.
+// マッチする文字列のバイト数は substr と異なる場合があります.
+func SFold(substr string) Pattern {
+	nd := &node{op: opLiteral, str: substr, fold: true}
+	return nd.pattern(func(s string, i int) int {
+		if i > len(s) {
 			return -1
 		}
+		for _, r := range nd.str {
+			if i >= len(s) {
+				return -1
+			}
+			c, w := utf8.DecodeRuneInString(s[i:])
+			if c != r && !equalFold(c, r) {
+				return -1
+			}
+			i += w
+		}
 		return i
+	})
+}
+
+// equalFold は a, b が単純大文字小文字畳み込みで等しいかを返します.
+func equalFold(a, b rune) bool {
+	if a < utf8.RuneSelf && b < utf8.RuneSelf {
+		if 'A' <= a && a <= 'Z' {
+			a += 'a' - 'A'
+		}
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		return a == b
 	}
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+	return false
 }
 
+// Head は先頭を表す Pattern を返します.
+func Head() Pattern {
+	return head
+}
+
+// head は Head が返す Pattern です.
+var head = (&node{op: opHead}).static(func(s string, i int) int {
+	if i > 0 {
+		return -1
+	}
+	return i
+})
+
 // Tail は末尾を表す Pattern を返します.
 func Tail() Pattern {
-	return func(s string, i int) int {
+	return tail
+}
+
+// tail は Tail が返す Pattern です.
+var tail = (&node{op: opTail}).static(func(s string, i int) int {
+	if i < len(s) {
+		return -1
+	}
+	return i
+})
+
+// LineStart は行頭を表す Pattern を返します.
+//
+// 先頭と \n の直後にマッチします. 正規表現の (?m:^) と同等です.
+func LineStart() Pattern {
+	return lineStart
+}
+
+// lineStart は LineStart が返す Pattern です.
+var lineStart = (&node{op: opLineStart}).static(func(s string, i int) int {
+	if i > len(s) || i > 0 && s[i-1] != '\n' {
+		return -1
+	}
+	return i
+})
+
+// LineEnd は行末を表す Pattern を返します.
+//
+// 末尾と改行の直前にマッチします. 改行は \n と \r\n で, \r\n の \r と \n の間にはマッチしません.
+func LineEnd() Pattern {
+	return lineEnd
+}
+
+// lineEnd は LineEnd が返す Pattern です.
+var lineEnd = (&node{op: opLineEnd}).static(func(s string, i int) int {
+	switch {
+	case i == len(s):
+		return i
+	case i > len(s):
+		return -1
+	case s[i] == '\n' && (i == 0 || s[i-1] != '\r'):
+		return i
+	case s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n':
+		return i
+	}
+	return -1
+})
+
+// unicodeWord は Unicode の単語の文字です.
+var unicodeWord = Is(unicode.L, unicode.M, unicode.N, unicode.Pc)
+
+// WordBoundary は単語の境界を表す Pattern を返します.
+//
+// 前後の文字の一方だけが単語の文字 (0-9, A-Z, a-z, _) である位置にマッチします.
+// 先頭と末尾は単語の文字でない文字として扱います. 正規表現の \b と同等です.
+func WordBoundary() Pattern {
+	return boundary(opWordBoundary, Word())
+}
+
+// NotWordBoundary は単語の境界でない位置を表す Pattern を返します.
+//
+// 正規表現の \B と同等です.
+func NotWordBoundary() Pattern {
+	return boundary(opNotWordBoundary, Word())
+}
+
+// UnicodeWordBoundary は Unicode の単語の境界を表す Pattern を返します.
+//
+// WordBoundary と同じですが, 単語の文字は Unicode の文字, 結合文字, 数字, 連結符 (\pL, \pM, \pN, \p{Pc}) です.
+//
+//	// 「東京」と「tokyo」の前後にマッチします.
+//	FindAllIndex(nil, UnicodeWordBoundary(), "東京 tokyo", -1)
+func UnicodeWordBoundary() Pattern {
+	return boundary(opWordBoundary, unicodeWord)
+}
+
+// NotUnicodeWordBoundary は Unicode の単語の境界でない位置を表す Pattern を返します.
+func NotUnicodeWordBoundary() Pattern {
+	return boundary(opNotWordBoundary, unicodeWord)
+}
+
+// boundary は単語の文字が word の WordBoundary, NotWordBoundary の Pattern を返します.
+func boundary(op op, word CharClass) Pattern {
+	nd := &node{op: op, class: word}
+	not := op == opNotWordBoundary
+	return nd.pattern(func(s string, i int) int {
+		if i > len(s) {
+			return -1
+		}
+		before, after := false, false
+		if i > 0 {
+			r, _ := utf8.DecodeLastRuneInString(s[:i])
+			before = nd.class(r)
+		}
 		if i < len(s) {
+			r, _ := utf8.DecodeRuneInString(s[i:])
+			after = nd.class(r)
+		}
+		if (before != after) == not {
 			return -1
 		}
 		return i
-	}
+	})
 }
 
 // Block は順次指定した Pattern とマッチする Pattern を返します.
+//
+// ChLazy, RepeatLazy を含むときは, 後続の Pattern がマッチするまでそれらの繰り返しの回数を増やします.
 func Block(pats ...Pattern) Pattern {
-	return func(s string, i int) int {
+	return block(pats).pat
+}
+
+// block は Block の node を返します.
+func block(pats []Pattern) *node {
+	subs := nodesOf(pats)
+	nd := &node{op: opBlock, subs: subs, names: namesOf(subs)}
+	for _, sub := range subs {
+		nd.lazy = nd.lazy || sub.lazy
+	}
+	nd.pattern(func(s string, i int) int {
+		if nd.lazy {
+			return nd.step(&machine{}, s, i, 0, accept)
+		}
 		var next int
 		for _, pat := range pats {
 			if next = pat(s, i); next < 0 {
@@ -110,41 +272,167 @@ func Block(pats ...Pattern) Pattern {
 			i = next
 		}
 		return i
-	}
+	})
+	return nd
 }
 
 // Repeat は min, max 回の繰り返しにマッチする Pattern を返します.
 //
 //	min, max の使用方法:
 //		0, 1 ... 正規表現の ? と同等です.
-//		0, n ... 正規表現の * に似た評価をします.
-//		1, n ... 正規表現の + に似た評価をします.
+//		0, Inf ... 正規表現の * に似た評価をします.
+//		1, Inf ... 正規表現の + に似た評価をします.
+//
+// Repeat は Ch と同様に, 後続の Pattern のために繰り返しを戻しません.
+// 空文字列にマッチした繰り返しはそれ以上繰り返しても同じなので, その時点で max 回の繰り返しとみなします.
 func Repeat(min, max uint, pats ...Pattern) Pattern {
-	pat := Block(pats...)
-	return func(s string, i int) int {
+	sub := block(pats)
+	nd := &node{op: opRepeat, min: min, max: max, subs: []*node{sub}, names: sub.names}
+	return nd.pattern(func(s string, i int) int {
+		pat := nd.subs[0].pat
 		var next int
 		var n uint
 		for ; n < max; n++ {
 			if next = pat(s, i); next < 0 {
 				break
 			}
+			if next == i {
+				n = max
+				break
+			}
 			i = next
 		}
 		if n < min {
 			return -1
 		}
 		return i
-	}
+	})
+}
+
+// RepeatLazy は Repeat と同じく min, max 回の繰り返しに, できるだけ少ない回数でマッチする Pattern を返します.
+//
+// RepeatLazy は Block, Backtrack の中で後続の Pattern がマッチするまで繰り返しを 1 回ずつ増やします.
+// 正規表現の (?:...)*? などに相当します.
+func RepeatLazy(min, max uint, pats ...Pattern) Pattern {
+	sub := block(pats)
+	nd := &node{op: opRepeat, min: min, max: max, lazy: true, subs: []*node{sub}, names: sub.names}
+	return nd.pattern(func(s string, i int) int {
+		return nd.step(&machine{}, s, i, 0, accept)
+	})
+}
+
+// Many は Ch(0, Inf, classes...) と同じく, キャラクタクラスの 0 文字以上の文字列にマッチする Pattern を返します.
+//
+// 正規表現の [...]* と同等です.
+func Many(classes ...CharClass) Pattern {
+	return Ch(0, Inf, classes...)
+}
+
+// Many1 は Ch(1, Inf, classes...) と同じく, キャラクタクラスの 1 文字以上の文字列にマッチする Pattern を返します.
+//
+// 正規表現の [...]+ と同等です.
+func Many1(classes ...CharClass) Pattern {
+	return Ch(1, Inf, classes...)
+}
+
+// Star は Repeat(0, Inf, pats...) と同じく, 0 回以上の繰り返しにマッチする Pattern を返します.
+//
+// 正規表現の (?:...)* と同等です.
+func Star(pats ...Pattern) Pattern {
+	return Repeat(0, Inf, pats...)
+}
+
+// Plus は Repeat(1, Inf, pats...) と同じく, 1 回以上の繰り返しにマッチする Pattern を返します.
+//
+// 正規表現の (?:...)+ と同等です.
+func Plus(pats ...Pattern) Pattern {
+	return Repeat(1, Inf, pats...)
+}
+
+// Opt は Repeat(0, 1, pats...) と同じく, 省略できる Pattern を返します.
+//
+// 正規表現の (?:...)? と同等です.
+func Opt(pats ...Pattern) Pattern {
+	return Repeat(0, 1, pats...)
 }
 
 // Any は指定した Pattern のいずれかとマッチする Pattern を返します.
 func Any(pats ...Pattern) Pattern {
-	return func(s string, i int) int {
-		for _, pat := range pats {
-			if next := pat(s, i); next >= 0 {
+	subs := nodesOf(pats)
+	nd := &node{op: opAny, subs: subs, names: namesOf(subs)}
+	return nd.pattern(func(s string, i int) int {
+		for _, sub := range nd.subs {
+			if next := sub.pat(s, i); next >= 0 {
 				return next
 			}
 		}
 		return -1
-	}
+	})
+}
+
+// Backtrack は指定した Pattern と順次, 後戻りしながらマッチする Pattern を返します.
+//
+// Backtrack の中の Ch, Repeat は後続の Pattern がマッチするまで文字や繰り返しを戻し,
+// Any は後続の Pattern がマッチするまで次の Pattern を試します.
+// 正規表現と同じ評価をしますが, Block より遅くなります.
+//
+//	// `.*>`
+//	Backtrack(Ch(0, 256, All()), S(">"))
+func Backtrack(pats ...Pattern) Pattern {
+	sub := block(pats)
+	nd := &node{op: opBacktrack, subs: []*node{sub}, names: sub.names}
+	return nd.pattern(func(s string, i int) int {
+		if i > len(s) {
+			return -1
+		}
+		return nd.subs[0].run(&machine{}, s, i, 0, accept)
+	})
+}
+
+// Capture は指定した Pattern とマッチした範囲をサブマッチとして記録する Pattern を返します.
+//
+// サブマッチは正規表現の (...) と同様に, 開始位置の順に 1 から番号が付きます.
+// サブマッチは FindSubmatchIndex, FindSubmatch などで取り出します.
+func Capture(pats ...Pattern) Pattern {
+	return NamedCapture("", pats...)
+}
+
+// NamedCapture は名前付きのサブマッチを記録する Pattern を返します.
+//
+// 正規表現の (?P<name>...) と同等です.
+// 名前は SubexpNames で取り出します.
+func NamedCapture(name string, pats ...Pattern) Pattern {
+	sub := block(pats)
+	nd := &node{op: opCapture, str: name, lazy: sub.lazy, subs: []*node{sub}}
+	nd.names = append([]string{name}, sub.names...)
+	return nd.pattern(func(s string, i int) int {
+		return nd.subs[0].pat(s, i)
+	})
+}
+
+// Ref は評価するときの *p と同じ評価をする Pattern を返します.
+//
+// Ref は *p を評価のたびに参照するので, 自身を含む Pattern を記述できます.
+// *p は Ref を評価する前に設定しなければなりません.
+//
+// Ref の先は構造を調べないので, First などは Ref の先の先頭文字を特定せず,
+// FindSubmatchIndex は Ref の先のサブマッチを記録しません.
+// Ref の先を後戻りさせるには, Ref の先の Pattern を Backtrack にします.
+//
+// 左再帰には対応していません. Block(Ref(&p), ...) のように文字を消費せずに同じ位置で自身に戻る p は,
+// 再帰が止まらずに goroutine のスタックが溢れ, プログラムが終了します.
+// 左再帰は Star などの繰り返しに書き換えます.
+//
+//	// 対応の取れた括弧 `\((?:[^()]+|(?R))*\)`
+//	var paren Pattern
+//	paren = Block(S("("), Star(Any(Many1(Not("()")), Ref(&paren))), S(")"))
+func Ref(p *Pattern) Pattern {
+	nd := &node{op: opRef, ref: p}
+	return nd.pattern(func(s string, i int) int {
+		pat := *nd.ref
+		if pat == nil {
+			panic("patb: Ref to nil Pattern")
+		}
+		return pat(s, i)
+	})
 }
@@ -1,6 +1,11 @@
 package patb
 
-import "testing"
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
 
 func TestPattern(t *testing.T) {
 	tests := []struct {
@@ -28,6 +33,19 @@ func TestPattern(t *testing.T) {
 			"aiu": 3,
 			"あいう": -1,
 		}},
+		{`(?i)sip`, SFold("sip"), map[string]int{
+			"sip":  3,
+			"SIP:": 3,
+			"Sips": 3,
+			"si":   -1,
+			"tel":  -1,
+		}},
+		{`(?i)kσ`, SFold("kσ"), map[string]int{
+			"kσ":      3,
+			"KΣ":      3,
+			"\u212Aς": 5,
+			"kx":      -1,
+		}},
 		{`\w+@\w+`, Block(Ch(1, 3, Word()), S("@"), Ch(1, 3, Word())), map[string]int{
 			"a@b":     3,
 			"abc@xyz": 7,
@@ -52,6 +70,33 @@ func TestPattern(t *testing.T) {
 			"xyz": 3,
 			"aba": -1,
 		}},
+		{`.*>`, Block(Ch(0, 16, All()), S(">")), map[string]int{
+			"<a>":   -1,
+			"<a>b>": -1,
+		}},
+		{`.*>`, Backtrack(Ch(0, 16, All()), S(">")), map[string]int{
+			"":      -1,
+			"<a>":   3,
+			"<a>b>": 5,
+			"<a>b":  3,
+		}},
+		{`(a|ab)c`, Backtrack(Any(S("a"), S("ab")), S("c")), map[string]int{
+			"ac":  2,
+			"abc": 3,
+			"abd": -1,
+		}},
+		{`(\d+,){1,3}\d+,`, Backtrack(Repeat(1, 3, Ch(1, 3, Digit()), S(",")), Ch(1, 3, Digit()), S(",")), map[string]int{
+			"1,":       -1,
+			"1,2,":     4,
+			"1,2,3,":   6,
+			"1,2,3,4,": 8,
+			"1,2,3,4":  6,
+		}},
+		{`(x*)*y`, Backtrack(Repeat(0, 16, Ch(0, 4, C("x"))), S("y")), map[string]int{
+			"y":   1,
+			"xxy": 3,
+			"xxz": -1,
+		}},
 		{
 			`^[^@]+@(\w+\.)+\w+$`,
 			Block(
@@ -83,3 +128,199 @@ func TestPattern(t *testing.T) {
 		}
 	}
 }
+
+func TestAnchor(t *testing.T) {
+	texts := []string{"", "foo bar", "a\nbc\n\nd\n", "foo_1.bar-x", "あa い", " x "}
+	tests := []struct {
+		expr string
+		pat  Pattern
+	}{
+		{`\b`, WordBoundary()},
+		{`\B`, NotWordBoundary()},
+		{`\b\w+\b`, Block(WordBoundary(), Ch(1, 16, Word()), WordBoundary())},
+		{`(?m:^)`, LineStart()},
+		{`(?m:^)[^\n]+`, Block(LineStart(), Ch(1, 16, Not("\n")))},
+		{`(?m:$)`, LineEnd()},
+	}
+	for _, te := range tests {
+		re := regexp.MustCompile(te.expr)
+		for _, s := range texts {
+			var got [][]int
+			for _, m := range FindAllIndex(nil, te.pat, s, -1) {
+				got = append(got, []int{m[0], m[1]})
+			}
+			if want := re.FindAllStringIndex(s, -1); !reflect.DeepEqual(got, want) {
+				t.Errorf("FindAllIndex(`%s`, %q) = %v, want %v", te.expr, s, got, want)
+			}
+		}
+	}
+
+	tests2 := []struct {
+		name string
+		pat  Pattern
+		s    string
+		want [][2]int
+	}{
+		{`LineEnd`, LineEnd(), "a\r\nb\r\n\nc\r", [][2]int{{1, 1}, {4, 4}, {6, 6}, {9, 9}}},
+		{`LineStart.+LineEnd`, Block(LineStart(), Ch(1, 16, Not("\r\n")), LineEnd()), "ab\r\ncd\nef", [][2]int{{0, 2}, {4, 6}, {7, 9}}},
+		{`UnicodeWordBoundary`, UnicodeWordBoundary(), "東京 tokyo", [][2]int{{0, 0}, {6, 6}, {7, 7}, {12, 12}}},
+		{`NotUnicodeWordBoundary`, NotUnicodeWordBoundary(), "東京 x", [][2]int{{3, 3}}},
+		{`WordBoundary`, WordBoundary(), "東京 x", [][2]int{{7, 7}, {8, 8}}},
+	}
+	for _, te := range tests2 {
+		if got := FindAllIndex(nil, te.pat, te.s, -1); !reflect.DeepEqual(got, te.want) {
+			t.Errorf("FindAllIndex(`%s`, %q) = %v, want %v", te.name, te.s, got, te.want)
+		}
+	}
+}
+
+func TestLazy(t *testing.T) {
+	tests := []struct {
+		name string
+		pat  Pattern
+		s    string
+		want [][2]int
+	}{
+		{`"[^\n]*?"`, Block(S(`"`), ChLazy(0, 256, Not("\n")), S(`"`)), `"a" and "b"`, [][2]int{{0, 3}, {8, 11}}},
+		{`<.*?>`, Block(S("<"), ChLazy(0, 256, All()), S(">")), "<a><b>", [][2]int{{0, 3}, {3, 6}}},
+		{`<(?:.)*?>`, Block(S("<"), RepeatLazy(0, 256, Dot()), S(">")), "<a><b>", [][2]int{{0, 3}, {3, 6}}},
+		{`(?:ab)+?b`, Block(RepeatLazy(1, 8, S("ab")), S("b")), "ababb abb", [][2]int{{0, 5}, {6, 9}}},
+		{`x(?:\d+?y)`, Block(S("x"), Block(ChLazy(1, 8, Digit()), S("y"))), "x12y x1", [][2]int{{0, 4}}},
+		{`\d{2,5}?`, ChLazy(2, 5, Digit()), "12345", [][2]int{{0, 2}, {2, 4}}},
+		{`.{0,8}+.*?>`, Block(Ch(0, 8, All()), ChLazy(0, 8, All()), S(">")), "<a>", nil},
+		{`(?:.{0,8}?)+>`, Block(Repeat(1, 8, ChLazy(0, 8, All())), S(">")), "<a>", [][2]int{{2, 3}}},
+	}
+	for _, te := range tests {
+		for _, pat := range []Pattern{te.pat, Optimize(te.pat)} {
+			if got := FindAllIndex(nil, pat, te.s, -1); !reflect.DeepEqual(got, te.want) {
+				t.Errorf("FindAllIndex(`%s`, %q) = %v, want %v", te.name, te.s, got, te.want)
+			}
+		}
+	}
+
+	pat := Block(Capture(ChLazy(1, 8, All())), S("@"), Capture(Ch(1, 8, Alnum())))
+	if got, want := FindSubmatchIndex(nil, pat, "a@b@c", 0), []int{0, 3, 0, 1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindSubmatchIndex(`(.+?)@(\\w+)`) = %v, want %v", got, want)
+	}
+	pat = Block(RepeatLazy(0, 4, Capture(Dot())), S("c"))
+	if got, want := FindSubmatchIndex(nil, pat, "abc", 0), []int{0, 3, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindSubmatchIndex(`(.)*?c`) = %v, want %v", got, want)
+	}
+}
+
+func TestInf(t *testing.T) {
+	long := strings.Repeat("0123456789", 1000)
+	tests := []struct {
+		name string
+		pat  Pattern
+		s    string
+		want int
+	}{
+		{`\d+`, Many1(Digit()), long, len(long)},
+		{`\d*`, Many(Digit()), "abc", 0},
+		{`(?:ab)*`, Star(S("ab")), "ababa", 4},
+		{`(?:\d{1,3},)+`, Plus(Ch(1, 3, Digit()), S(",")), strings.Repeat("123,", 1000) + "4", 4000},
+		{`(?:ab)?`, Opt(S("ab")), "abab", 2},
+		{`(?:x?)*`, Star(Ch(0, 1, C("x"))), "xxy", 2},
+		{`(?:\d?)+`, Plus(Ch(0, 1, Digit())), "a", 0},
+		{`(?:){2}`, Repeat(2, 2, S("")), "a", 0},
+		{`(?:(?:x*)*y)`, Backtrack(Star(Many(C("x"))), S("y")), "xxy", 3},
+	}
+	for _, te := range tests {
+		if got := te.pat(te.s, 0); got != te.want {
+			t.Errorf("%s (%.16q) = %d, want %d", te.name, te.s, got, te.want)
+		}
+	}
+
+	pat := Plus(Capture(Ch(0, 1, Digit())))
+	re := regexp.MustCompile(`(\d?)+`)
+	for _, s := range []string{"12a", "a"} {
+		if got, want := FindSubmatchIndex(nil, pat, s, 0), re.FindStringSubmatchIndex(s); !reflect.DeepEqual(got, want) {
+			t.Errorf("FindSubmatchIndex(`(\\d?)+`, %q) = %v, want %v", s, got, want)
+		}
+	}
+	if got, want := Block(Many1(Not("@")), S("@"), Plus(Many1(Alnum()), Opt(S(".")))).String(), `[^@]+@(?:[0-9A-Za-z]+\.?)+`; got != want {
+		t.Errorf("String() = `%s`, want `%s`", got, want)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	// 不正な UTF-8 のバイトは regexp と同じく 1 バイトの utf8.RuneError として扱います.
+	tests := []struct {
+		pat  Pattern
+		s    string
+		want int
+	}{
+		{Ch(1, 3, All()), "\xff\xfe", 2},
+		{Ch(2, 2, Not("a")), "\xe3\x81a", 2},
+		{Many1(Not("a")), "a\xffb", -1},
+		{Many1(Not("a")), "\xffb", 2},
+		{Block(Dot(), S("b")), "\xffb", 2},
+	}
+	for _, te := range tests {
+		if got := te.pat(te.s, 0); got != te.want {
+			t.Errorf("(%q) = %d, want %d", te.s, got, te.want)
+		}
+	}
+
+	if got, want := ReplaceAll(nil, Many1(Not("a")), "a\xffb", "X"), "aX"; got != want {
+		t.Errorf("ReplaceAll(%q) = %q, want %q", "a\xffb", got, want)
+	}
+	if got, want := FindAllIndex(nil, Many1(Not("a")), "\xffa\xe3\x81", -1), [][2]int{{0, 1}, {2, 4}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllIndex(%q) = %v, want %v", "\xffa\xe3\x81", got, want)
+	}
+}
+
+func TestRef(t *testing.T) {
+	var paren Pattern
+	paren = Block(S("("), Star(Any(Many1(Not("()")), Ref(&paren))), S(")"))
+	if got, want := FindAllIndex(nil, paren, "x(a(b)c) (d))(", -1), [][2]int{{1, 8}, {9, 12}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllIndex(paren) = %v, want %v", got, want)
+	}
+
+	var value Pattern
+	ws := Many(Space())
+	str := Block(S(`"`), Many(Not(`"`)), S(`"`))
+	array := Block(S("["), ws, Opt(Ref(&value), Star(ws, S(","), ws, Ref(&value))), ws, S("]"))
+	member := Block(str, ws, S(":"), ws, Ref(&value))
+	object := Block(S("{"), ws, Opt(member, Star(ws, S(","), ws, member)), ws, S("}"))
+	value = Any(str, Many1(Digit()), array, object)
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{`{"a": [1, 2, {"b": "c"}], "d": []}`, true},
+		{`[[[[1]]], {}]`, true},
+		{`{"a": [1, }`, false},
+		{`[1, [2]`, false},
+	}
+	for _, te := range tests {
+		if got := Equal(value, te.s); got != te.want {
+			t.Errorf("Equal(value, %q) = %t, want %t", te.s, got, te.want)
+		}
+	}
+
+	if got, want := paren.String(), `\((?:[^\(\)]+|(?#ref))*\)`; got != want {
+		t.Errorf("String() = `%s`, want `%s`", got, want)
+	}
+	if got, want := Optimize(paren).Tree(), "Block\n  S \"(\"\n  Repeat *\n    Any\n      Ch [^\\(\\)]+\n      Ref\n  S \")\"\n"; got != want {
+		t.Errorf("Tree() = %q, want %q", got, want)
+	}
+	if got := First(Ref(&paren)); !got('x') {
+		t.Errorf("First(Ref) ('x') = false, want true")
+	}
+}
+
+func TestPatternRelease(t *testing.T) {
+	keep := Block(S("a"), Capture(Ch(1, 2, Digit())))
+	before := count(&known)
+	for i := 0; i < 10000; i++ {
+		Block(S("a"), Capture(Ch(1, 2, Digit())), Any(S("b"), Dot(), Ref(&keep)))
+	}
+	if !released(&known, before) {
+		t.Errorf("known has %d entries, want <= %d", count(&known), before+100)
+	}
+	if got, want := FindSubmatchIndex(nil, keep, "xa12", 0), []int{1, 4, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindSubmatchIndex(`%s`) = %v, want %v", keep, got, want)
+	}
+}
@@ -0,0 +1,476 @@
+package patb
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// String は p と同じ評価をする正規表現を返します.
+//
+// 正規表現は regexp パッケージ (RE2) の構文です. Ch, Repeat, Any が後戻りしないことは表せません.
+// RE2 にない Ahead, NotAhead, Behind, NotBehind は Perl の (?=...), (?!...), (?<=...), (?<!...) と表します.
+// patb が作っていない Pattern は (?#func), Ref は (?#ref) と表します.
+//
+//	// `sip:[^>@]{1,32}@`
+//	Block(S("sip:"), Ch(1, 32, Not("@>")), S("@")).String()
+func (p Pattern) String() string {
+	var b strings.Builder
+	nodeOf(p).render(&b, precAlt)
+	return b.String()
+}
+
+// Tree は p の構造を字下げした木で返します.
+//
+//	Block
+//	  S "sip:"
+//	  Ch [^>@]{1,32}
+//	  S "@"
+func (p Pattern) Tree() string {
+	var b strings.Builder
+	nodeOf(p).tree(&b, 0)
+	return b.String()
+}
+
+// String は c と同じ文字にマッチする正規表現のキャラクタクラスを返します.
+//
+// patb が作っていない CharClass は [[:func:]] と表します.
+func (c CharClass) String() string {
+	return setOf(c).String()
+}
+
+// 正規表現の演算子の優先順位です.
+const (
+	precAlt    = iota // x|y
+	precConcat        // xy, x*
+	precAtom          // x, (x)
+)
+
+// prec は n を表す正規表現の優先順位を返します.
+func (n *node) prec() int {
+	switch n.op {
+	case opChar:
+		if n.min == 1 && n.max == 1 {
+			return precAtom
+		}
+		return precConcat
+	case opLiteral:
+		if n.fold || utf8.RuneCountInString(n.str) == 1 {
+			return precAtom
+		}
+		return precConcat
+	case opBlock:
+		switch len(n.subs) {
+		case 0:
+			return precConcat
+		case 1:
+			return n.subs[0].prec()
+		}
+		return precConcat
+	case opRepeat:
+		return precConcat
+	case opAny:
+		switch len(n.subs) {
+		case 0:
+			return precAtom
+		case 1:
+			return n.subs[0].prec()
+		}
+		return precAlt
+	case opBacktrack:
+		return n.subs[0].prec()
+	}
+	return precAtom
+}
+
+// render は n を表す正規表現を b に書き込みます.
+//
+// n の優先順位が need より低ければ (?:...) で囲みます.
+func (n *node) render(b *strings.Builder, need int) {
+	if n.prec() < need {
+		b.WriteString("(?:")
+		n.render(b, precAlt)
+		b.WriteString(")")
+		return
+	}
+	switch n.op {
+	case opFunc:
+		b.WriteString("(?#func)")
+	case opRef:
+		b.WriteString("(?#ref)")
+	case opDot:
+		b.WriteString("(?s:.)")
+	case opChar:
+		b.WriteString(setOf(n.class).String())
+		b.WriteString(n.quantifier())
+	case opLiteral:
+		switch {
+		case n.fold:
+			b.WriteString("(?i:")
+			quote(b, n.str)
+			b.WriteString(")")
+		default:
+			quote(b, n.str)
+		}
+	case opHead:
+		b.WriteString("^")
+	case opTail:
+		b.WriteString("$")
+	case opLineStart:
+		b.WriteString("(?m:^)")
+	case opLineEnd:
+		b.WriteString(`(?=\r\n|(?<!\r)\n|\z)`)
+	case opWordBoundary, opNotWordBoundary:
+		if n.asciiWord() {
+			if n.op == opWordBoundary {
+				b.WriteString(`\b`)
+			} else {
+				b.WriteString(`\B`)
+			}
+			break
+		}
+		w := setOf(n.class).String()
+		if n.op == opWordBoundary {
+			b.WriteString("(?:(?<=" + w + ")(?!" + w + ")|(?<!" + w + ")(?=" + w + "))")
+		} else {
+			b.WriteString("(?:(?<=" + w + ")(?=" + w + ")|(?<!" + w + ")(?!" + w + "))")
+		}
+	case opBlock:
+		switch len(n.subs) {
+		case 1:
+			n.subs[0].render(b, need)
+		default:
+			for _, sub := range n.subs {
+				sub.render(b, precConcat)
+			}
+		}
+	case opRepeat:
+		n.subs[0].render(b, precAtom)
+		b.WriteString(n.quantifier())
+	case opAny:
+		switch len(n.subs) {
+		case 0:
+			b.WriteString(`[^\x00-\x{10FFFF}]`)
+		case 1:
+			n.subs[0].render(b, need)
+		default:
+			for i, sub := range n.subs {
+				if i > 0 {
+					b.WriteString("|")
+				}
+				sub.render(b, precConcat)
+			}
+		}
+	case opCapture:
+		if n.str == "" {
+			b.WriteString("(")
+		} else {
+			b.WriteString("(?P<" + n.str + ">")
+		}
+		n.subs[0].render(b, precAlt)
+		b.WriteString(")")
+	case opBacktrack:
+		n.subs[0].render(b, need)
+	case opAhead, opNotAhead, opBehind, opNotBehind:
+		b.WriteString(lookaroundPrefix[n.op])
+		n.subs[0].render(b, precAlt)
+		b.WriteString(")")
+	}
+}
+
+// lookaroundPrefix は先読み, 後読みの正規表現の開始の表記です.
+var lookaroundPrefix = map[op]string{
+	opAhead:     "(?=",
+	opNotAhead:  "(?!",
+	opBehind:    "(?<=",
+	opNotBehind: "(?<!",
+}
+
+// tree は n の構造を depth の字下げで b に書き込みます.
+func (n *node) tree(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	subs := n.subs
+	switch n.op {
+	case opFunc:
+		b.WriteString("func")
+	case opRef:
+		b.WriteString("Ref")
+	case opDot:
+		b.WriteString("Dot")
+	case opChar:
+		b.WriteString("Ch " + setOf(n.class).String() + n.quantifier())
+	case opLiteral:
+		if n.fold {
+			b.WriteString("SFold " + strconv.Quote(n.str))
+		} else {
+			b.WriteString("S " + strconv.Quote(n.str))
+		}
+	case opHead:
+		b.WriteString("Head")
+	case opTail:
+		b.WriteString("Tail")
+	case opLineStart:
+		b.WriteString("LineStart")
+	case opLineEnd:
+		b.WriteString("LineEnd")
+	case opWordBoundary, opNotWordBoundary:
+		if n.op == opNotWordBoundary {
+			b.WriteString("Not")
+		}
+		if !n.asciiWord() {
+			b.WriteString("Unicode")
+		}
+		b.WriteString("WordBoundary")
+	case opBlock:
+		b.WriteString("Block")
+	case opRepeat:
+		b.WriteString("Repeat")
+		if q := n.quantifier(); q != "" {
+			b.WriteString(" " + q)
+		}
+		subs = subs[0].subs
+	case opAny:
+		b.WriteString("Any")
+	case opCapture:
+		if n.str == "" {
+			b.WriteString("Capture")
+		} else {
+			b.WriteString("NamedCapture " + strconv.Quote(n.str))
+		}
+		subs = subs[0].subs
+	case opBacktrack:
+		b.WriteString("Backtrack")
+		subs = subs[0].subs
+	case opAhead:
+		b.WriteString("Ahead")
+		subs = subs[0].subs
+	case opNotAhead:
+		b.WriteString("NotAhead")
+		subs = subs[0].subs
+	case opBehind:
+		b.WriteString("Behind")
+		subs = subs[0].subs
+	case opNotBehind:
+		b.WriteString("NotBehind")
+		subs = subs[0].subs
+	}
+	b.WriteString("\n")
+	for _, sub := range subs {
+		sub.tree(b, depth+1)
+	}
+}
+
+// asciiWord は n の単語の文字が WordBoundary と同じ 0-9, A-Z, a-z, _ かを返します.
+func (n *node) asciiWord() bool {
+	return setOf(n.class) == setOf(Word())
+}
+
+// quantifier は n の繰り返しを表す正規表現の量指定子を返します.
+//
+// ChLazy, RepeatLazy は *? などの最短一致の量指定子で表します.
+func (n *node) quantifier() string {
+	q := quantifier(n.min, n.max)
+	if n.lazy && q != "" {
+		q += "?"
+	}
+	return q
+}
+
+// quantifier は min, max 回の繰り返しを表す正規表現の量指定子を返します.
+func quantifier(min, max uint) string {
+	switch {
+	case min == 1 && max == 1:
+		return ""
+	case min == 0 && max == 1:
+		return "?"
+	case max == Inf && min == 0:
+		return "*"
+	case max == Inf && min == 1:
+		return "+"
+	case max == Inf:
+		return "{" + strconv.FormatUint(uint64(min), 10) + ",}"
+	case min == max:
+		return "{" + strconv.FormatUint(uint64(min), 10) + "}"
+	}
+	return "{" + strconv.FormatUint(uint64(min), 10) + "," + strconv.FormatUint(uint64(max), 10) + "}"
+}
+
+// quote は s の文字を正規表現でエスケープして b に書き込みます.
+func quote(b *strings.Builder, s string) {
+	for _, r := range s {
+		quoteRune(b, r)
+	}
+}
+
+// quoteRune は r を正規表現でエスケープして b に書き込みます.
+//
+// キャラクタクラスの中でも使えるように - もエスケープします.
+func quoteRune(b *strings.Builder, r rune) {
+	switch {
+	case r < utf8.RuneSelf && strings.ContainsRune(`\.+*?()|[]{}^$-`, r):
+		b.WriteByte('\\')
+		b.WriteRune(r)
+	case r == '\t':
+		b.WriteString(`\t`)
+	case r == '\n':
+		b.WriteString(`\n`)
+	case r == '\r':
+		b.WriteString(`\r`)
+	case r == '\f':
+		b.WriteString(`\f`)
+	case r == '\v':
+		b.WriteString(`\v`)
+	case !unicode.IsPrint(r) || r == utf8.RuneError:
+		b.WriteString(`\x{` + strconv.FormatInt(int64(r), 16) + `}`)
+	default:
+		b.WriteRune(r)
+	}
+}
+
+// String は cs の正規表現の表記を返します.
+func (cs *charset) String() string {
+	if cs.rest != nil {
+		if cs.name != "" {
+			return cs.name
+		}
+		return "[[:func:]]"
+	}
+	ranges := cs.all()
+	switch {
+	case len(ranges) == 0:
+		return `[^\x00-\x{10FFFF}]`
+	case len(ranges) == 1 && ranges[0] == runeRange{0, utf8.MaxRune}:
+		return "(?s:.)"
+	case len(ranges) == 1 && ranges[0].lo == ranges[0].hi:
+		var b strings.Builder
+		quoteRune(&b, ranges[0].lo)
+		return b.String()
+	}
+	if inv := invertRanges(ranges, 0); len(inv) < len(ranges) {
+		return "[^" + rangesString(inv) + "]"
+	}
+	return "[" + rangesString(ranges) + "]"
+}
+
+// inner は cs を角括弧の中に書く表記を返します.
+//
+// 角括弧の中に書けないときは ok に false を返します.
+func (cs *charset) inner() (s string, ok bool) {
+	name := cs.name
+	switch {
+	case cs.rest == nil:
+		return rangesString(cs.all()), true
+	case strings.HasPrefix(name, `\p`), strings.HasPrefix(name, `\P`):
+		return name, true
+	case strings.HasPrefix(name, "[") && !strings.HasPrefix(name, "[^"):
+		return name[1 : len(name)-1], true
+	}
+	return "", false
+}
+
+// all は cs にマッチする文字の範囲を ASCII を含めて返します.
+func (cs *charset) all() []runeRange {
+	var v []runeRange
+	for r := rune(0); r < utf8.RuneSelf; r++ {
+		if cs.ascii[r>>6]&(1<<(r&63)) == 0 {
+			continue
+		}
+		if n := len(v); n > 0 && v[n-1].hi == r-1 {
+			v[n-1].hi = r
+		} else {
+			v = append(v, runeRange{r, r})
+		}
+	}
+	for _, rg := range cs.ranges {
+		if n := len(v); n > 0 && v[n-1].hi == rg.lo-1 {
+			v[n-1].hi = rg.hi
+		} else {
+			v = append(v, rg)
+		}
+	}
+	return v
+}
+
+// rangesString は ranges を角括弧の中に書く表記を返します.
+func rangesString(ranges []runeRange) string {
+	var b strings.Builder
+	for _, rg := range ranges {
+		quoteRune(&b, rg.lo)
+		if rg.hi > rg.lo+1 {
+			b.WriteString("-")
+		}
+		if rg.hi > rg.lo {
+			quoteRune(&b, rg.hi)
+		}
+	}
+	return b.String()
+}
+
+// invertName は name の否定の表記を返します.
+func invertName(name string) string {
+	switch {
+	case strings.HasPrefix(name, `\p`):
+		return `\P` + name[2:]
+	case strings.HasPrefix(name, `\P`):
+		return `\p` + name[2:]
+	case strings.HasPrefix(name, "[^"):
+		return "[" + name[2:]
+	case strings.HasPrefix(name, "["):
+		return "[^" + name[1:]
+	}
+	return ""
+}
+
+// unionName は sets の和集合の表記を返します.
+//
+// 角括弧の中に書けない charset を含むときは "" を返します.
+func unionName(sets []*charset) string {
+	var b strings.Builder
+	b.WriteString("[")
+	for _, s := range sets {
+		t, ok := s.inner()
+		if !ok {
+			return ""
+		}
+		b.WriteString(t)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// tablesName は Unicode の範囲表 tables の表記を返します.
+//
+// unicode.Categories, unicode.Scripts にない範囲表を含むときは "" を返します.
+func tablesName(tables []*unicode.RangeTable) string {
+	var v []string
+	for _, t := range tables {
+		name := tableName(t)
+		if name == "" {
+			return ""
+		}
+		v = append(v, name)
+	}
+	if len(v) == 1 {
+		return v[0]
+	}
+	return "[" + strings.Join(v, "") + "]"
+}
+
+// tableName は Unicode の範囲表 t の \p{Name} の表記を返します.
+func tableName(t *unicode.RangeTable) string {
+	for name, u := range unicode.Categories {
+		if u == t {
+			if len(name) == 1 {
+				return `\p` + name
+			}
+			return `\p{` + name + `}`
+		}
+	}
+	for name, u := range unicode.Scripts {
+		if u == t {
+			return `\p{` + name + `}`
+		}
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package patb
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"unicode"
+)
+
+func TestPatternString(t *testing.T) {
+	tests := []struct {
+		pat  Pattern
+		want string
+	}{
+		{Block(S("sip:"), Ch(1, 32, Not("@>")), S("@")), `sip:[^>@]{1,32}@`},
+		{Ch(3, 5, Alphabet()), `[A-Za-z]{3,5}`},
+		{Ch(1, 1, C("a")), `a`},
+		{Ch(0, 1, Digit()), `[0-9]?`},
+		{Ch(0, 256, All()), `(?s:.){0,256}`},
+		{Block(Dot(), Head(), Tail()), `(?s:.)^$`},
+		{S("a.b*"), `a\.b\*`},
+		{SFold("abc"), `(?i:abc)`},
+		{Repeat(0, 1, S("ab")), `(?:ab)?`},
+		{Repeat(2, 2, S("a"), Ch(1, 1, Word())), `(?:a[0-9A-Z_a-z]){2}`},
+		{Any(S("a"), S("bc"), Block()), `a|bc|`},
+		{Repeat(0, 2, S("")), `(?:){0,2}`},
+		{Block(S("x"), Any(S("a"), S("b"))), `x(?:a|b)`},
+		{Repeat(1, 3, Any(S("a"), S("b"))), `(?:a|b){1,3}`},
+		{Capture(S("a"), Any(S("b"), S("c"))), `(a(?:b|c))`},
+		{NamedCapture("user", Ch(1, 64, Not("@"))), `(?P<user>[^@]{1,64})`},
+		{Backtrack(Ch(0, 256, All()), S(">")), `(?s:.){0,256}>`},
+		{Ch(1, 1, Letter()), `\pL`},
+		{Ch(1, 1, Invert(Letter())), `\PL`},
+		{Ch(1, 1, Or(Digit(), Hiragana())), `[0-9\p{Hiragana}]`},
+		{Ch(1, 1, Minus(Letter(), Lower())), `[^\PLa-z]`},
+		{Ch(1, 1, Is(unicode.Greek, unicode.Cyrillic)), `[\p{Greek}\p{Cyrillic}]`},
+		{Ch(1, 1, Range('ぁ', 'ゖ')), `[ぁ-ゖ]`},
+		{Ch(1, 1, C("\t\n-]")), `[\t\n\-\]]`},
+		{Block(Ch(1, 1, C("ab")), Ch(1, 1, C("cd")), Ch(1, 1, Not("ef"))), `[ab][cd][^ef]`},
+		{Ch(1, 1, Or()), `[^\x00-\x{10FFFF}]`},
+		{Ch(1, 1, func(r rune) bool { return r == 'a' }), `[[:func:]]`},
+		{Block(S("a"), func(s string, i int) int { return i }), `a(?#func)`},
+		{Block(NotBehind(S("s")), S("sip:"), Ahead(Ch(1, 1, Digit()))), `(?<!s)sip:(?=[0-9])`},
+		{Block(Behind(Any(S("<"), Head())), NotAhead(S("a"), S("b"))), `(?<=<|^)(?!ab)`},
+		{Block(WordBoundary(), S("ab"), NotWordBoundary()), `\bab\B`},
+		{Block(S("<"), ChLazy(1, 32, Not(">")), S(">")), `<[^>]{1,32}?>`},
+		{Block(RepeatLazy(0, 1, S("ab")), ChLazy(1, 1, Digit())), `(?:ab)??[0-9]`},
+		{Block(LineStart(), S("a"), LineEnd()), `(?m:^)a(?=\r\n|(?<!\r)\n|\z)`},
+		{UnicodeWordBoundary(), `(?:(?<=[\pL\pM\pN\p{Pc}])(?![\pL\pM\pN\p{Pc}])|(?<![\pL\pM\pN\p{Pc}])(?=[\pL\pM\pN\p{Pc}]))`},
+	}
+	for _, te := range tests {
+		if got := te.pat.String(); got != te.want {
+			t.Errorf("String() = `%s`, want `%s`", got, te.want)
+		}
+	}
+}
+
+func TestPatternStringCompile(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{`[^@]+@(\w+\.)+\w+`, []string{"a@b", "a@b.c", "dum.my@go.dev"}},
+		{`^(sip|tel|sips):([^@>]*@)?([^>:]*)(:[0-9]{1,5})?$`, []string{"sip:a@b", "sips:b:5060", "tel:0312341234"}},
+		{`(?P<user>[^@]+)@(?:\w+)`, []string{"foo@bar", "@bar"}},
+		{`[[:alpha:]]+[[:^digit:][:punct:]]`, []string{"abc1", "ab.", "12", "a:b"}},
+	}
+	for _, te := range tests {
+		pat, _ := MustCompile(te.expr)
+		re, err := regexp.Compile(pat.String())
+		if err != nil {
+			t.Errorf("String() of `%s` = `%s` errored %v", te.expr, pat, err)
+			continue
+		}
+		want := regexp.MustCompile(te.expr)
+		for _, s := range te.want {
+			if got, want := re.FindStringSubmatchIndex(s), want.FindStringSubmatchIndex(s); !reflect.DeepEqual(got, want) {
+				t.Errorf("String() of `%s` = `%s` (%q) = %v, want %v", te.expr, pat, s, got, want)
+			}
+		}
+	}
+}
+
+func TestPatternTree(t *testing.T) {
+	pat := Backtrack(
+		NamedCapture("user", Ch(1, 64, Not("@"))),
+		S("@"),
+		Repeat(0, 1, Any(S("a"), SFold("b"))),
+		Tail(),
+	)
+	want := `Backtrack
+  NamedCapture "user"
+    Ch [^@]{1,64}
+  S "@"
+  Repeat ?
+    Any
+      S "a"
+      SFold "b"
+  Tail
+`
+	if got := pat.Tree(); got != want {
+		t.Errorf("Tree() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,212 @@
+package patb
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// DefaultMaxMatch は Scanner の既定の最大マッチ長です.
+const DefaultMaxMatch = 64 * 1024
+
+var (
+	// ErrTooLong はマッチが Scanner の最大マッチ長を超えたことを表します.
+	ErrTooLong = errors.New("patb: match too long")
+
+	// ErrNoProgress は io.Reader がデータもエラーも返さないことを表します.
+	ErrNoProgress = errors.New("patb: too many reads without progress")
+)
+
+// Scanner は io.Reader から pat に一致する部分を順に読み出します.
+//
+// Scanner はすべてのデータを読み込まず, 最大マッチ長の 2 倍のバッファを移動しながら検索します.
+// バッファの境界をまたぐマッチも検出しますが,
+// pat は最大マッチ長を超える範囲の文字を参照しない必要があります.
+// 最大マッチ長以上のマッチが見つかると Scan は ErrTooLong で終了します.
+//
+// 空文字列の一致は FindAllFunc と同じく扱います.
+//
+// Head は入力の先頭とマッチします. Scanner は直前の 1 文字だけを保持するので,
+// それより前の文字を参照する Pattern は正しく評価できません.
+//
+//	sc := NewScanner(r, nil, pat)
+//	for sc.Scan() {
+//		f, l := sc.Index()
+//		fmt.Println(f, l, sc.Text())
+//	}
+//	if err := sc.Err(); err != nil {
+//		return err
+//	}
+type Scanner struct {
+	r   io.Reader
+	fd  finder
+	max int
+
+	buf  []byte
+	off  int64 // buf[0] の入力中の位置
+	pos  int   // 次に検索する buf の位置
+	end  int   // buf に読み込んだデータの終わり
+	f, l int   // 直前のマッチの buf の範囲
+	prev int   // 直前のマッチの終わりの buf の位置 (なければ負の値)
+	eof  bool
+	err  error
+
+	// gap が nil でなければマッチしなかった部分を順に渡します.
+	gap  func(b []byte)
+	mark int // gap に渡していない buf の位置
+}
+
+// NewScanner は r から pat に一致する部分を読み出す Scanner を返します.
+//
+// c は FindIndex と同じくマッチする文字列の先頭文字のキャラクタクラスです.
+func NewScanner(r io.Reader, c CharClass, pat Pattern) *Scanner {
+	return &Scanner{
+		r:    r,
+		fd:   finderOf(c, pat),
+		max:  DefaultMaxMatch,
+		prev: -1,
+	}
+}
+
+// MaxMatch は最大マッチ長を n バイトに設定します.
+//
+// MaxMatch は Scan を呼び出す前に呼び出さなければなりません.
+func (sc *Scanner) MaxMatch(n int) {
+	if sc.buf != nil {
+		panic("patb: MaxMatch called after Scan")
+	}
+	if n < utf8.UTFMax {
+		n = utf8.UTFMax
+	}
+	sc.max = n
+}
+
+// Scan は次のマッチを検索します.
+// マッチが見つかれば true を返します.
+// 入力の終わりに達するかエラーが発生すると false を返します.
+func (sc *Scanner) Scan() bool {
+	if sc.buf == nil {
+		sc.buf = make([]byte, 2*sc.max+utf8.UTFMax)
+	}
+	for sc.err == nil {
+		if sc.find() {
+			return true
+		}
+		if sc.eof {
+			return false
+		}
+		sc.fill()
+	}
+	return false
+}
+
+// find は読み込んだデータから次のマッチを検索します.
+//
+// マッチが見つかれば true を, 検索を続けるデータが足りなければ false を返します.
+// 入力の終わりまで検索するとマッチしなかった残りを gap に渡します.
+func (sc *Scanner) find() bool {
+	limit := sc.end - sc.max
+	if sc.eof {
+		limit = sc.end
+	}
+	s := bstr(sc.buf[:sc.end])
+	for sc.pos < limit || sc.eof && sc.pos == limit {
+		pos := sc.fd.skip(s, sc.pos)
+		if pos < 0 || pos >= limit && !sc.eof {
+			// limit 以降は次の fill の後で検索します.
+			for sc.pos = limit; sc.pos < sc.end && !utf8.RuneStart(sc.buf[sc.pos]); sc.pos++ {
+			}
+			break
+		}
+		sc.pos = pos
+		if l := sc.fd.pat(s, pos); l >= 0 && (l != pos || pos != sc.prev) {
+			if l-pos >= sc.max {
+				sc.err = ErrTooLong
+				return false
+			}
+			sc.f, sc.l, sc.prev = pos, l, l
+			if sc.gap != nil {
+				sc.gap(sc.buf[sc.mark:sc.f])
+				sc.mark = l
+			}
+			if sc.pos = l; l == pos && pos < sc.end {
+				sc.pos = nextRune(s, pos)
+			}
+			return true
+		}
+		if pos == sc.end {
+			// 入力の終わりまで検索しました.
+			break
+		}
+		sc.pos = nextRune(s, pos)
+	}
+	if sc.eof && sc.gap != nil {
+		sc.gap(sc.buf[sc.mark:sc.end])
+		sc.mark = sc.end
+	}
+	return false
+}
+
+// shift は検索済みのデータを捨てます.
+//
+// Head などのために直前の 1 文字は残します.
+func (sc *Scanner) shift() {
+	from := sc.pos
+	if from > 0 {
+		_, w := utf8.DecodeLastRune(sc.buf[:from])
+		from -= w
+	}
+	if sc.gap != nil && sc.mark < from {
+		sc.gap(sc.buf[sc.mark:from])
+		sc.mark = from
+	}
+	copy(sc.buf, sc.buf[from:sc.end])
+	sc.off += int64(from)
+	sc.pos, sc.end, sc.mark, sc.prev = sc.pos-from, sc.end-from, sc.mark-from, sc.prev-from
+	sc.f, sc.l = 0, 0
+}
+
+// fill は検索済みのデータを捨ててバッファを読み込みます.
+func (sc *Scanner) fill() {
+	sc.shift()
+	for empty := 0; sc.end < len(sc.buf); {
+		n, err := sc.r.Read(sc.buf[sc.end:])
+		sc.end += n
+		if err == io.EOF {
+			sc.eof = true
+			return
+		} else if err != nil {
+			sc.err = err
+			return
+		}
+		if n > 0 {
+			empty = 0
+		} else if empty++; empty >= 100 {
+			sc.err = ErrNoProgress
+			return
+		}
+	}
+}
+
+// Bytes は直前のマッチを返します.
+//
+// 戻り値は次の Scan で上書きされます.
+func (sc *Scanner) Bytes() []byte {
+	return sc.buf[sc.f:sc.l:sc.l]
+}
+
+// Text は直前のマッチを文字列で返します.
+func (sc *Scanner) Text() string {
+	return string(sc.buf[sc.f:sc.l])
+}
+
+// Index は直前のマッチの入力中の範囲を返します.
+func (sc *Scanner) Index() (f, l int64) {
+	return sc.off + int64(sc.f), sc.off + int64(sc.l)
+}
+
+// Err は Scan で発生したエラーを返します.
+// 入力の終わりに達したときは nil を返します.
+func (sc *Scanner) Err() error {
+	return sc.err
+}
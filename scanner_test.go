@@ -0,0 +1,85 @@
+package patb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestScanner(t *testing.T) {
+	// `<sip:[^>]+>`
+	pat := Block(S("<sip:"), Ch(1, 32, Not(">")), S(">"))
+	line := `"display_name"<sip:0312341234@10.0.0.1:5060>;user=phone` + "\n"
+	text := strings.Repeat(line+"<sip:whois.this>\n", 20)
+
+	type match struct {
+		f, l int64
+		m    string
+	}
+	var want []match
+	for f, l := FindIndex(C("<"), pat, text, 0); f >= 0; f, l = FindIndex(C("<"), pat, text, l) {
+		want = append(want, match{int64(f), int64(l), text[f:l]})
+	}
+
+	for _, max := range []int{0, 40, 100, DefaultMaxMatch} {
+		sc := NewScanner(iotest.HalfReader(strings.NewReader(text)), C("<"), pat)
+		if max > 0 {
+			sc.MaxMatch(max)
+		}
+		var got []match
+		for sc.Scan() {
+			f, l := sc.Index()
+			got = append(got, match{f, l, sc.Text()})
+		}
+		if err := sc.Err(); err != nil {
+			t.Errorf("Scanner(%d) errored %v", max, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Scanner(%d) = %v, want %v", max, got, want)
+		}
+	}
+
+	sc := NewScanner(iotest.OneByteReader(strings.NewReader("xあabxxabあ")), nil, S("ab"))
+	sc.MaxMatch(1)
+	var idx [][2]int64
+	for sc.Scan() {
+		f, l := sc.Index()
+		idx = append(idx, [2]int64{f, l})
+	}
+	if want := [][2]int64{{4, 6}, {8, 10}}; !reflect.DeepEqual(idx, want) {
+		t.Errorf("Scanner(1) = %v, want %v", idx, want)
+	}
+
+	sc = NewScanner(strings.NewReader(text), nil, Block(Head(), S(`"`)))
+	sc.MaxMatch(16)
+	var n int
+	for sc.Scan() {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Scanner(Head) matched %d times, want 1", n)
+	}
+
+	for _, s := range []string{"", "a12b345", "あ1い"} {
+		digits := Ch(0, 3, Digit())
+		sc = NewScanner(iotest.OneByteReader(strings.NewReader(s)), nil, digits)
+		sc.MaxMatch(4)
+		var got [][2]int
+		for sc.Scan() {
+			f, l := sc.Index()
+			got = append(got, [2]int{int(f), int(l)})
+		}
+		if want := FindAllIndex(nil, digits, s, -1); !reflect.DeepEqual(got, want) {
+			t.Errorf("Scanner(%q) = %v, want %v", s, got, want)
+		}
+	}
+
+	sc = NewScanner(strings.NewReader(text), nil, pat)
+	sc.MaxMatch(16)
+	for sc.Scan() {
+	}
+	if err := sc.Err(); err != ErrTooLong {
+		t.Errorf("Scanner(16) errored %v, want %v", err, ErrTooLong)
+	}
+}
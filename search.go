@@ -0,0 +1,204 @@
+package patb
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// finder は FindIndex の検索方法です.
+type finder struct {
+	pat Pattern
+
+	// skip は s[i:] から pat がマッチし得る最初の位置を返します.
+	// 候補がなければ -1 を返します.
+	skip func(s string, i int) int
+}
+
+// finderOf は c, pat で検索する finder を返します.
+//
+// c が nil のときは pat の構造から選んだ検索方法を使用します.
+func finderOf(c CharClass, pat Pattern) finder {
+	if c != nil {
+		return finder{pat: pat, skip: skipClass(c)}
+	}
+	return finder{pat: pat, skip: nodeOf(pat).skipper()}
+}
+
+// index は s[i:] から pat に一致する範囲を返します.
+//
+// pat が空文字列にマッチし得るときは s の終わり len(s) の位置も評価します.
+func (fd *finder) index(s string, i int) (f int, l int) {
+	for i <= len(s) {
+		if i = fd.skip(s, i); i < 0 {
+			break
+		}
+		if next := fd.pat(s, i); next >= 0 {
+			return i, next
+		}
+		i = nextRune(s, i)
+	}
+	return -1, -1
+}
+
+// all は s から pat に一致する範囲を順に fn に渡します.
+//
+// overlap が false のときは直前の一致の終わりから, true のときは直前の一致の開始位置の次の文字から検索を続けます.
+// 空文字列の一致は regexp パッケージと同じく扱います.
+// 空文字列に一致したときは次の文字から検索を続け,
+// overlap が false のときは直前の一致の終わりに接する空文字列の一致を渡しません.
+// fn が false を返すと終了します.
+func (fd *finder) all(s string, overlap bool, fn func(f, l int) bool) {
+	for i, prev := 0, -1; i <= len(s); {
+		f, l := fd.index(s, i)
+		if f < 0 {
+			return
+		}
+		if overlap || l != f || f != prev {
+			if !fn(f, l) {
+				return
+			}
+		}
+		prev = l
+		if i = l; overlap || l == f {
+			i = nextRune(s, f)
+		}
+	}
+}
+
+// nextRune は s[i] から始まる文字の次の位置を返します.
+//
+// i が s の終わりなら len(s)+1 を返します.
+func nextRune(s string, i int) int {
+	if i >= len(s) {
+		return i + 1
+	}
+	_, w := utf8.DecodeRuneInString(s[i:])
+	return i + w
+}
+
+// maxIndexAny は strings.IndexAny で探す先頭文字の最大数です.
+const maxIndexAny = 8
+
+// skipper は n にマッチし得る位置を探す関数を返します.
+//
+// 先頭の文字列が決まれば strings.Index, strings.IndexByte で,
+// 先頭文字が数文字に決まれば strings.IndexByte, strings.Index, strings.IndexAny で探します.
+// それ以外は先頭文字の charset で探します.
+func (n *node) skipper() func(s string, i int) int {
+	n.skipOnce.Do(func() {
+		n.skip = n.strategy()
+	})
+	return n.skip
+}
+
+// strategy は n の検索方法を選びます.
+func (n *node) strategy() func(s string, i int) int {
+	if prefix := n.hoist(); len(prefix) == 1 {
+		return skipByte(prefix[0])
+	} else if prefix != "" {
+		return skipString(prefix)
+	}
+	classes, empty, ok := n.first()
+	if !ok || empty {
+		return skipNone
+	}
+	cs := union(setsOf(classes))
+	if cs.rest != nil || cs.has(utf8.RuneError) {
+		// 不正な UTF-8 のバイトは utf8.RuneError として判定するので, 文字列では探せません.
+		return skipSet(cs)
+	}
+	var chars []rune
+	for _, rg := range cs.all() {
+		for r := rg.lo; r <= rg.hi && len(chars) <= maxIndexAny; r++ {
+			chars = append(chars, r)
+		}
+	}
+	switch {
+	case len(chars) == 0:
+		return skipNever
+	case len(chars) == 1 && chars[0] < utf8.RuneSelf:
+		return skipByte(byte(chars[0]))
+	case len(chars) == 1:
+		return skipString(string(chars[0]))
+	case len(chars) <= maxIndexAny:
+		return skipAny(string(chars))
+	}
+	return skipSet(cs)
+}
+
+// skipNone はすべての位置を候補にします.
+func skipNone(s string, i int) int {
+	return i
+}
+
+// skipNever はどの位置も候補にしません.
+func skipNever(s string, i int) int {
+	return -1
+}
+
+// skipByte は b の位置を候補にします.
+func skipByte(b byte) func(s string, i int) int {
+	return func(s string, i int) int {
+		if j := strings.IndexByte(s[i:], b); j >= 0 {
+			return i + j
+		}
+		return -1
+	}
+}
+
+// skipString は prefix の位置を候補にします.
+func skipString(prefix string) func(s string, i int) int {
+	return func(s string, i int) int {
+		if j := strings.Index(s[i:], prefix); j >= 0 {
+			return i + j
+		}
+		return -1
+	}
+}
+
+// skipAny は chars のいずれかの文字の位置を候補にします.
+func skipAny(chars string) func(s string, i int) int {
+	return func(s string, i int) int {
+		if j := strings.IndexAny(s[i:], chars); j >= 0 {
+			return i + j
+		}
+		return -1
+	}
+}
+
+// skipSet は cs にマッチする文字の位置を候補にします.
+//
+// ASCII はデコードせずにビットマップで判定します.
+func skipSet(cs *charset) func(s string, i int) int {
+	return func(s string, i int) int {
+		for i < len(s) {
+			if b := s[i]; b < utf8.RuneSelf {
+				if cs.ascii[b>>6]&(1<<(b&63)) != 0 {
+					return i
+				}
+				i++
+				continue
+			}
+			r, w := utf8.DecodeRuneInString(s[i:])
+			if cs.has(r) {
+				return i
+			}
+			i += w
+		}
+		return -1
+	}
+}
+
+// skipClass は c にマッチする文字の位置を候補にします.
+//
+// 先頭文字のない s の終わりは c に関わらず候補にします.
+func skipClass(c CharClass) func(s string, i int) int {
+	return func(s string, i int) int {
+		for j, r := range s[i:] {
+			if c(r) {
+				return i + j
+			}
+		}
+		return len(s)
+	}
+}
@@ -0,0 +1,80 @@
+package patb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindIndexStrategy(t *testing.T) {
+	pats := []Pattern{
+		S("sip:"),
+		S("@"),
+		S("あい"),
+		Ch(1, 3, C("あ")),
+		Block(Ch(1, 1, C("<>")), S("x")),
+		Block(Ch(1, 1, CFold("k")), S("e")),
+		Ch(1, 2, Digit()),
+		Ch(1, 1, Letter()),
+		Any(S("ab"), Ch(1, 1, C("@")), S("x")),
+		Repeat(0, 1, S("a")),
+		Ch(1, 1, Or()),
+		S("\xff"),
+		Ch(1, 1, C("\uFFFD")),
+		Ch(1, 1, C("\uFFFDx")),
+		Block(Ch(2, 2, C("\uFFFD")), S("b")),
+	}
+	texts := []string{
+		"",
+		`"display_name"<sip:0312341234@10.0.0.1:5060>;user=phone`,
+		"xあああいう<x>x\xffab@\xe3\x81",
+		"KEYKe ke 12",
+		"a\xffb\uFFFD\xfe\xffbx",
+	}
+	for _, pat := range pats {
+		for _, s := range texts {
+			for i := 0; i < len(s); i++ {
+				f, l := FindIndex(nil, pat, s, i)
+				wf, wl := FindIndex(All(), pat, s, i)
+				if f != wf || l != wl {
+					t.Errorf("FindIndex(nil, `%s`, %q, %d) = %d, %d, want %d, %d", pat, s, i, f, l, wf, wl)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkFindIndex(b *testing.B) {
+	text := strings.Repeat(`"display_name"<tel:0312341234@10.0.0.1:5060>;user=phone;hogehoge`+"\n", 100) + "<sip:x@y>"
+
+	tests := []struct {
+		name string
+		pat  Pattern
+	}{
+		{"Index", Block(S("sip:"), Ch(1, 32, Not("@>")), S("@"))},
+		{"IndexByte", Block(S("<"), Ch(1, 8, Lower()), S(":x"))},
+		{"IndexAny", Block(Ch(1, 1, C("<[")), S("sip"))},
+		{"Set", Block(Ch(1, 1, Range('s', 'z')), S("ip"))},
+	}
+	for _, te := range tests {
+		b.Run(te.name+"/class", func(b *testing.B) {
+			c := First(te.pat)
+			for n := 0; n < b.N; n++ {
+				FindIndex(c, te.pat, text, 0)
+			}
+		})
+		b.Run(te.name+"/auto", func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				FindIndex(nil, te.pat, text, 0)
+			}
+		})
+	}
+}
+
+func TestFindIndexInvalidUTF8(t *testing.T) {
+	if f, l := FindIndex(nil, S("\xff"), "a\xffb", 0); f != 1 || l != 2 {
+		t.Errorf(`FindIndex(S("\xff")) = %d, %d, want 1, 2`, f, l)
+	}
+	if f, l := FindIndexBytes(nil, Ch(1, 1, C("\uFFFD")), []byte("a\xffb"), 0); f != 1 || l != 2 {
+		t.Errorf(`FindIndexBytes(C("\uFFFD")) = %d, %d, want 1, 2`, f, l)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build go1.23
+
+package patb
+
+import "iter"
+
+// FindAllSeq は s の中から pat と一致する範囲を順に返すイテレータを返します.
+//
+// 範囲は FindAllIndex と同じく重なりません.
+// range の途中で break すると検索を終えます.
+//
+//	for f, l := range FindAllSeq(nil, pat, s) {
+//		fmt.Println(s[f:l])
+//	}
+func FindAllSeq(c CharClass, pat Pattern, s string) iter.Seq2[int, int] {
+	return func(yield func(f, l int) bool) {
+		fd := finderOf(c, pat)
+		fd.all(s, false, yield)
+	}
+}
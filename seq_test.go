@@ -0,0 +1,31 @@
+//go:build go1.23
+
+package patb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindAllSeq(t *testing.T) {
+	pat := Ch(1, 16, Not(" "))
+	s := "abc あいう x"
+
+	var got [][2]int
+	for f, l := range FindAllSeq(nil, pat, s) {
+		got = append(got, [2]int{f, l})
+	}
+	if want := FindAllIndex(nil, pat, s, -1); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllSeq(`%s`, %q) = %v, want %v", pat, s, got, want)
+	}
+
+	got = got[:0]
+	for f, l := range FindAllSeq(nil, pat, s) {
+		if got = append(got, [2]int{f, l}); len(got) == 2 {
+			break
+		}
+	}
+	if want := FindAllIndex(nil, pat, s, 2); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllSeq(`%s`, %q) with break = %v, want %v", pat, s, got, want)
+	}
+}
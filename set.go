@@ -0,0 +1,293 @@
+package patb
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// Set は複数の Pattern をまとめて検索します.
+//
+// Set は s を 1 度だけ走査して, 各 Pattern がマッチし得る位置でだけ Pattern を評価します.
+// 先頭の文字列が決まる Pattern は Aho-Corasick 法で, 先頭文字が決まる Pattern は
+// 文字ごとの表で候補の位置を探します.
+//
+//	set := NewSet(sip, tel, mail)
+//	set.FindAllFunc(line, func(m SetMatch) error {
+//		fmt.Println(m.ID, line[m.Start:m.End])
+//		return nil
+//	})
+type Set struct {
+	pats []Pattern
+
+	ac     *automaton
+	ascii  [utf8.RuneSelf][]int // 先頭文字が ASCII の文字の Pattern
+	others []setClass           // 先頭文字に非 ASCII を含む Pattern
+	always []int                // 先頭を特定できない Pattern
+}
+
+// SetMatch は Set の Pattern にマッチした範囲です.
+type SetMatch struct {
+	ID         int // マッチした Pattern の番号
+	Start, End int // マッチした範囲 s[Start:End]
+}
+
+// setClass は先頭文字のキャラクタクラスが cs の Pattern です.
+type setClass struct {
+	cs *charset
+	id int
+}
+
+// NewSet は pats をまとめて検索する Set を返します.
+//
+// pats の番号 (0 から始まるインデックス) が SetMatch の ID です.
+func NewSet(pats ...Pattern) *Set {
+	set := &Set{pats: pats}
+	var prefixes []string
+	var ids []int
+	for id, pat := range pats {
+		n := nodeOf(pat)
+		if prefix := n.hoist(); prefix != "" {
+			prefixes, ids = append(prefixes, prefix), append(ids, id)
+			continue
+		}
+		classes, empty, ok := n.first()
+		if !ok || empty {
+			set.always = append(set.always, id)
+			continue
+		}
+		cs := union(setsOf(classes))
+		for r := rune(0); r < utf8.RuneSelf; r++ {
+			if cs.ascii[r>>6]&(1<<(r&63)) != 0 {
+				set.ascii[r] = append(set.ascii[r], id)
+			}
+		}
+		if cs.rest != nil || len(cs.ranges) > 0 {
+			set.others = append(set.others, setClass{cs, id})
+		}
+	}
+	if len(prefixes) > 0 {
+		set.ac = newAutomaton(prefixes, ids)
+	}
+	return set
+}
+
+// Len は Set の Pattern の数を返します.
+func (set *Set) Len() int {
+	return len(set.pats)
+}
+
+// FindIndex は s[i:] から最も左で Set のいずれかの Pattern に一致する範囲を返します.
+//
+// 同じ位置で複数の Pattern が一致するときは ID の小さい Pattern の範囲を返します.
+// 一致する部分がなければ -1, -1, -1 を返します.
+func (set *Set) FindIndex(s string, i int) (id, f, l int) {
+	id, f, l = -1, -1, -1
+	set.scan(s, i, nil, func(m SetMatch) bool {
+		id, f, l = m.ID, m.Start, m.End
+		return false
+	})
+	return id, f, l
+}
+
+// FindAllFunc は s の中から Set の各 Pattern と一致する部分を位置の順に fn に渡します.
+//
+// 各 Pattern の一致は FindAllFunc と同じく重なりません. 空文字列の一致も FindAllFunc と同じく扱います.
+// 異なる Pattern の一致は重なることがあります.
+// 同じ位置の一致は ID の順に渡します.
+// fn が error を返すとそのエラーを返します.
+func (set *Set) FindAllFunc(s string, fn func(m SetMatch) error) error {
+	next := make([]int, len(set.pats))
+	prev := make([]int, len(set.pats)) // 直前の一致の終わり
+	for id := range prev {
+		prev[id] = -1
+	}
+	var err error
+	set.scan(s, 0, next, func(m SetMatch) bool {
+		if m.End == m.Start && m.Start == prev[m.ID] {
+			// 直前の一致の終わりに接する空文字列の一致は渡しません.
+			return true
+		}
+		if next[m.ID], prev[m.ID] = m.End, m.End; m.End == m.Start {
+			next[m.ID]++
+		}
+		err = fn(m)
+		return err == nil
+	})
+	return err
+}
+
+// FindAll は s の中から Set の各 Pattern と一致する部分をすべて返します.
+//
+// 戻り値の順序は FindAllFunc と同じです.
+func (set *Set) FindAll(s string) []SetMatch {
+	var v []SetMatch
+	set.FindAllFunc(s, func(m SetMatch) error {
+		v = append(v, m)
+		return nil
+	})
+	return v
+}
+
+// Match は s の中に一致する部分がある Pattern の ID を昇順で返します.
+func (set *Set) Match(s string) []int {
+	var ids []int
+	next := make([]int, len(set.pats))
+	set.scan(s, 0, next, func(m SetMatch) bool {
+		ids = append(ids, m.ID)
+		next[m.ID] = len(s) + 1
+		return len(ids) < len(set.pats)
+	})
+	sort.Ints(ids)
+	return ids
+}
+
+// scan は s[i:] を走査して Pattern に一致した範囲を fn に渡します.
+//
+// next が nil でなければ next[id] より前の位置では id の Pattern を評価しません.
+// s の終わりでは先頭を特定できない Pattern だけを評価します.
+// fn が false を返すと走査を終えます.
+func (set *Set) scan(s string, i int, next []int, fn func(m SetMatch) bool) {
+	var ring [][]int // Aho-Corasick 法で見つけた候補 (位置 & mask ごと)
+	var mask int
+	state, ahead := int32(0), i
+	ac := set.ac
+	if ac != nil {
+		ring = make([][]int, ac.ringLen)
+		mask = ac.ringLen - 1
+	}
+	var cands []int
+	for p := i; p <= len(s); {
+		if p == len(s) {
+			set.try(s, p, set.always, next, fn)
+			return
+		}
+		var found []int
+		if ac != nil {
+			// p から始まる候補がすべて見つかるまで先に進めます.
+			for ; ahead < len(s) && ahead < p+ac.maxLen; ahead++ {
+				state = ac.delta[state][s[ahead]]
+				for _, o := range ac.out[state] {
+					start := ahead + 1 - o.len
+					ring[start&mask] = append(ring[start&mask], o.id)
+				}
+			}
+			found = ring[p&mask]
+			ring[p&mask] = found[:0]
+		}
+		r, w := rune(s[p]), 1
+		var dispatch []int
+		if r < utf8.RuneSelf {
+			dispatch = set.ascii[r]
+		} else if r, w = utf8.DecodeRuneInString(s[p:]); len(set.others) > 0 {
+			cands = cands[:0]
+			for _, sc := range set.others {
+				if sc.cs.has(r) {
+					cands = append(cands, sc.id)
+				}
+			}
+			dispatch = cands
+		}
+		if len(found)+len(dispatch)+len(set.always) == 0 {
+			p += w
+			continue
+		}
+		ids := found
+		if len(dispatch)+len(set.always) > 0 {
+			ids = append(append(append(cands[len(cands):], found...), dispatch...), set.always...)
+		}
+		// Aho-Corasick 法の候補は見つかった順なので, 常に ID の順に並べ替えます.
+		sort.Ints(ids)
+		if !set.try(s, p, ids, next, fn) {
+			return
+		}
+		p += w
+	}
+}
+
+// try は s[p:] で ids の Pattern を順に評価して, 一致した範囲を fn に渡します.
+//
+// fn が false を返すと false を返します.
+func (set *Set) try(s string, p int, ids []int, next []int, fn func(m SetMatch) bool) bool {
+	for _, id := range ids {
+		if next != nil && p < next[id] {
+			continue
+		}
+		if l := set.pats[id](s, p); l >= 0 {
+			if !fn(SetMatch{id, p, l}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// automaton は複数の文字列を 1 度の走査で探す Aho-Corasick 法の決定性オートマトンです.
+type automaton struct {
+	delta   [][256]int32 // 状態とバイトから次の状態への遷移
+	out     [][]acOutput // 状態で見つかる文字列
+	maxLen  int          // 最も長い文字列の長さ
+	ringLen int          // maxLen 以上の 2 の累乗
+}
+
+// acOutput は automaton で見つかった文字列です.
+type acOutput struct {
+	id  int // Pattern の番号
+	len int // 文字列の長さ
+}
+
+// newAutomaton は strs を探す automaton を返します.
+//
+// strs[k] が見つかると ids[k] を出力します.
+func newAutomaton(strs []string, ids []int) *automaton {
+	a := &automaton{delta: make([][256]int32, 1), out: make([][]acOutput, 1)}
+	const none = -1
+	for b := range a.delta[0] {
+		a.delta[0][b] = none
+	}
+	// トライ木を作ります.
+	for k, str := range strs {
+		state := 0
+		for j := 0; j < len(str); j++ {
+			if a.delta[state][str[j]] == none {
+				var row [256]int32
+				for b := range row {
+					row[b] = none
+				}
+				a.delta = append(a.delta, row)
+				a.out = append(a.out, nil)
+				a.delta[state][str[j]] = int32(len(a.delta) - 1)
+			}
+			state = int(a.delta[state][str[j]])
+		}
+		a.out[state] = append(a.out[state], acOutput{ids[k], len(str)})
+		if len(str) > a.maxLen {
+			a.maxLen = len(str)
+		}
+	}
+	for a.ringLen = 1; a.ringLen < a.maxLen; a.ringLen *= 2 {
+	}
+	// 幅優先で失敗遷移を求め, 遷移表に畳み込みます.
+	fail := make([]int32, len(a.delta))
+	var queue []int32
+	for b, next := range a.delta[0] {
+		if next == none {
+			a.delta[0][b] = 0
+		} else {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		a.out[state] = append(a.out[state], a.out[fail[state]]...)
+		for b, next := range a.delta[state] {
+			if next == none {
+				a.delta[state][b] = a.delta[fail[state]][b]
+			} else {
+				fail[next] = a.delta[fail[state]][b]
+				queue = append(queue, next)
+			}
+		}
+	}
+	return a
+}
@@ -0,0 +1,104 @@
+package patb
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	pats := []Pattern{
+		S("sip:"),
+		S("sips:"),
+		Block(S("ip"), Ch(0, 1, C("s"))),
+		Block(S("@"), Ch(1, 8, Alnum())),
+		Ch(3, 3, Digit()),
+		Ch(1, 4, Hiragana()),
+		Ch(0, 2, Digit()),
+		Block(Ch(1, 1, C("<>")), S("s")),
+		func(s string, i int) int {
+			if i+1 < len(s) && s[i] == s[i+1] {
+				return i + 2
+			}
+			return -1
+		},
+	}
+	set := NewSet(pats...)
+	texts := []string{
+		"",
+		`"display_name"<sip:0312341234@10.0.0.1:5060>;user=phone`,
+		"<sips:user@host> ひらがなとカタカナ tel:123\xff",
+		"sisipsips:",
+	}
+	for _, s := range texts {
+		var want []SetMatch
+		for id, pat := range pats {
+			for _, m := range FindAllIndex(nil, pat, s, -1) {
+				want = append(want, SetMatch{id, m[0], m[1]})
+			}
+		}
+		sort.Slice(want, func(i, j int) bool {
+			if want[i].Start != want[j].Start {
+				return want[i].Start < want[j].Start
+			}
+			return want[i].ID < want[j].ID
+		})
+		if got := set.FindAll(s); !reflect.DeepEqual(got, want) {
+			t.Errorf("FindAll(%q) = %v, want %v", s, got, want)
+		}
+
+		wid, wf, wl := -1, -1, -1
+		if len(want) > 0 {
+			wid, wf, wl = want[0].ID, want[0].Start, want[0].End
+		}
+		if id, f, l := set.FindIndex(s, 0); id != wid || f != wf || l != wl {
+			t.Errorf("FindIndex(%q) = %d, %d, %d, want %d, %d, %d", s, id, f, l, wid, wf, wl)
+		}
+
+		var ids []int
+		for id := range pats {
+			for _, m := range want {
+				if m.ID == id {
+					ids = append(ids, id)
+					break
+				}
+			}
+		}
+		if got := set.Match(s); !reflect.DeepEqual(got, ids) {
+			t.Errorf("Match(%q) = %v, want %v", s, got, ids)
+		}
+	}
+
+	// 同じ位置で長さの異なる文字列の候補
+	set = NewSet(S("abc"), S("ab"))
+	if id, f, l := set.FindIndex("xabc", 0); id != 0 || f != 1 || l != 4 {
+		t.Errorf("FindIndex(abc, ab) = %d, %d, %d, want 0, 1, 4", id, f, l)
+	}
+	if got, want := set.FindAll("xabc"), []SetMatch{{0, 1, 4}, {1, 1, 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll(abc, ab) = %v, want %v", got, want)
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	line := `2024-01-02 03:04:05 INFO "display_name"<sip:0312341234@10.0.0.1:5060>;user=phone;hogehoge`
+	var pats []Pattern
+	for _, w := range []string{"ERROR", "WARN", "FATAL", "panic:", "timeout", "refused", "sips:", "tel:", "mailto:", "https://"} {
+		pats = append(pats, S(w), Block(S("["+w), Ch(1, 8, Digit()), S("]")), Block(Ch(1, 1, C("#")), SFold(w)))
+	}
+	pats = append(pats, Block(S("sip:"), Ch(1, 32, Not("@>")), S("@")))
+
+	b.Run("FindIndex", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for _, pat := range pats {
+				FindIndex(nil, pat, line, 0)
+			}
+		}
+	})
+	b.Run("Set", func(b *testing.B) {
+		set := NewSet(pats...)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			set.Match(line)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package patb
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/text/transform"
+)
+
+// ReplaceStream は src から読み込んだデータの pat に一致する部分を置換して dst に書き込みます.
+//
+// ReplaceWrite のストリーム版です. src のすべてを読み込まずに Scanner と同じ方法で検索します.
+// 最大マッチ長は DefaultMaxMatch です.
+//
+// コールバック関数はパターンに一致した文字列を受け取り, 対応する置換文字列を Writer に書き込みます.
+// コールバック関数が SkipAll を返すと, 以降の置換をスキップして src の残りをそのまま書き込みます.
+// それ以外の error を返された場合, ReplaceStream はその error を返します.
+func ReplaceStream(dst Writer, src io.Reader, c CharClass, pat Pattern, fn func(w Writer, m string) error) error {
+	var werr error
+	sc := NewScanner(src, c, pat)
+	sc.gap = func(b []byte) {
+		if werr == nil {
+			_, werr = dst.Write(b)
+		}
+	}
+	for sc.Scan() {
+		err := fn(dst, sc.Text())
+		if err == SkipAll {
+			sc.gap(sc.buf[sc.l:sc.end])
+			if werr == nil && !sc.eof {
+				_, werr = io.Copy(dst, src)
+			}
+			return werr
+		} else if err != nil {
+			return err
+		}
+		if werr != nil {
+			return werr
+		}
+	}
+	if sc.err != nil {
+		return sc.err
+	}
+	return werr
+}
+
+// Transformer は pat に一致する部分を置換する transform.Transformer です.
+//
+// ReplaceStream と同じ置換を golang.org/x/text/transform のパッケージで使用できます.
+// Transform は src をすべて消費し, 最大マッチ長までのデータを内部に保持します.
+// コールバック関数が error を返したときは Reset するまで使用できません.
+type Transformer struct {
+	sc   Scanner
+	fn   func(w Writer, m string) error
+	out  bytes.Buffer // dst に書き込んでいない出力
+	skip bool         // SkipAll が返された
+}
+
+var _ transform.Transformer = (*Transformer)(nil)
+
+// NewTransformer は pat に一致する部分を fn で置換する Transformer を返します.
+//
+// c, fn は ReplaceStream と同じです.
+func NewTransformer(c CharClass, pat Pattern, fn func(w Writer, m string) error) *Transformer {
+	t := &Transformer{sc: *NewScanner(nil, c, pat), fn: fn}
+	t.sc.gap = func(b []byte) {
+		t.out.Write(b)
+	}
+	return t
+}
+
+// NewReplaceReader は r から読み込んだデータの pat に一致する部分を fn で置換する io.Reader を返します.
+func NewReplaceReader(r io.Reader, c CharClass, pat Pattern, fn func(w Writer, m string) error) io.Reader {
+	return transform.NewReader(r, NewTransformer(c, pat, fn))
+}
+
+// MaxMatch は最大マッチ長を n バイトに設定します.
+//
+// MaxMatch は Transform を呼び出す前に呼び出さなければなりません.
+func (t *Transformer) MaxMatch(n int) {
+	t.sc.MaxMatch(n)
+}
+
+// Transform は transform.Transformer の Transform を実装します.
+func (t *Transformer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	sc := &t.sc
+	if t.skip {
+		t.out.Write(src)
+	} else {
+		if sc.pos > sc.max {
+			sc.shift()
+		}
+		sc.buf = append(sc.buf[:sc.end], src...)
+		sc.end, sc.eof = len(sc.buf), atEOF
+		for sc.find() {
+			err := t.fn(&t.out, string(sc.buf[sc.f:sc.l]))
+			if err == SkipAll {
+				t.out.Write(sc.buf[sc.l:sc.end])
+				sc.pos, sc.mark = sc.end, sc.end
+				t.skip = true
+				break
+			} else if err != nil {
+				return 0, 0, err
+			}
+		}
+		if sc.err != nil {
+			return 0, 0, sc.err
+		}
+	}
+	nDst = copy(dst, t.out.Bytes())
+	t.out.Next(nDst)
+	if t.out.Len() > 0 {
+		return nDst, len(src), transform.ErrShortDst
+	}
+	return nDst, len(src), nil
+}
+
+// Reset は transform.Transformer の Reset を実装します.
+func (t *Transformer) Reset() {
+	sc := &t.sc
+	sc.buf = sc.buf[:0]
+	sc.off, sc.pos, sc.end, sc.f, sc.l, sc.mark, sc.prev = 0, 0, 0, 0, 0, 0, -1
+	sc.eof, sc.err = false, nil
+	t.out.Reset()
+	t.skip = false
+}
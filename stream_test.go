@@ -0,0 +1,81 @@
+package patb
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/text/transform"
+)
+
+func TestReplaceStream(t *testing.T) {
+	// `sip:[^@]+@`
+	pat := Block(S("sip:"), Ch(1, 32, Not("@>")), S("@"))
+	line := `"display_name"<sip:0312341234@10.0.0.1:5060>;user=phone` + "\n"
+	text := strings.Repeat(line+"<sip:whois.this>\n", 3000)
+	want := strings.ReplaceAll(text, "0312341234@", "***@")
+	mask := func(w Writer, m string) error {
+		w.WriteString("sip:***@")
+		return nil
+	}
+
+	w := bytes.NewBuffer(make([]byte, 0, len(text)))
+	if err := ReplaceStream(w, iotest.HalfReader(strings.NewReader(text)), nil, pat, mask); err != nil {
+		t.Errorf("ReplaceStream() errored %v", err)
+	}
+	if got := w.String(); got != want {
+		t.Errorf("ReplaceStream() = %q, want %q", got[:64], want[:64])
+	}
+
+	w.Reset()
+	ReplaceStream(w, strings.NewReader(text), nil, pat, func(w Writer, m string) error {
+		w.WriteString("sip:***@")
+		return SkipAll
+	})
+	if got, want := w.String(), strings.Replace(text, "0312341234@", "***@", 1); got != want {
+		t.Errorf("ReplaceStream(SkipAll) = %q, want %q", got[:64], want[:64])
+	}
+
+	got, err := io.ReadAll(NewReplaceReader(iotest.OneByteReader(strings.NewReader(text)), nil, pat, mask))
+	if err != nil {
+		t.Errorf("NewReplaceReader() errored %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("NewReplaceReader() = %q, want %q", got[:64], want[:64])
+	}
+
+	tr := NewTransformer(nil, pat, mask)
+	tr.MaxMatch(64)
+	got, _, err = transform.Bytes(tr, []byte(text))
+	if err != nil {
+		t.Errorf("transform.Bytes() errored %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("transform.Bytes() = %q, want %q", got[:64], want[:64])
+	}
+	s, _, _ := transform.String(tr, line)
+	if want := strings.Replace(line, "0312341234@", "***@", 1); s != want {
+		t.Errorf("transform.String() = %q, want %q", s, want)
+	}
+
+	digits := Ch(0, 3, Digit())
+	dash := func(w Writer, m string) error {
+		w.WriteByte('-')
+		return nil
+	}
+	for _, s := range []string{"", "a12b345", "あ1い"} {
+		want := ReplaceAll(nil, digits, s, "-")
+		w.Reset()
+		if err := ReplaceStream(w, iotest.OneByteReader(strings.NewReader(s)), nil, digits, dash); err != nil {
+			t.Errorf("ReplaceStream(%q) errored %v", s, err)
+		}
+		if got := w.String(); got != want {
+			t.Errorf("ReplaceStream(%q) = %q, want %q", s, got, want)
+		}
+		if got, _, _ := transform.String(NewTransformer(nil, digits, dash), s); got != want {
+			t.Errorf("transform.String(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
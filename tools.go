@@ -3,7 +3,6 @@ package patb
 import (
 	"bytes"
 	"io"
-	"unicode/utf8"
 
 	"github.com/17e10/go-notifyb"
 )
@@ -37,33 +36,137 @@ func Match(c CharClass, pat Pattern, s string) bool {
 // FindIndex は s[i:] から pat に一致する範囲を返します.
 // パターンに一致した文字列は s[f:l] です.
 // 一致する部分がなければ -1, -1 を返します.
+//
+// c に nil を指定すると First(pat) を使用します.
+// このとき pat の先頭の文字列や先頭文字から, strings.Index などの速い方法で候補の位置を探します.
 func FindIndex(c CharClass, pat Pattern, s string, i int) (f int, l int) {
-	t := s[i:]
-	for _, r := range t {
-		if c(r) {
-			if next := pat(s, i); next >= 0 {
-				return i, next
-			}
-		}
-		i += utf8.RuneLen(r)
-	}
-	return -1, -1
+	fd := finderOf(c, pat)
+	return fd.index(s, i)
 }
 
 // FindAllFunc は s の中から pat と一致する部分を fn に渡します.
 // fn が error を返すとそのエラーを返します.
+//
+// 一致する部分は重なりません. 空文字列の一致は regexp パッケージと同じく,
+// 直前の一致の終わりに接するものを除いて s の終わりまで 1 文字ごとに渡します.
 func FindAllFunc(c CharClass, pat Pattern, s string, fn func(m string) error) error {
-	var f, l int
-	for {
-		f, l = FindIndex(c, pat, s, f)
-		if f < 0 {
-			return nil
-		}
-		if err := fn(s[f:l]); err != nil {
-			return err
+	var err error
+	fd := finderOf(c, pat)
+	fd.all(s, false, func(f, l int) bool {
+		err = fn(s[f:l])
+		return err == nil
+	})
+	return err
+}
+
+// FindAllIndex は s の中から pat と一致する範囲を最大 n 個返します.
+//
+// 範囲は重なりません. n が負のときはすべての範囲を返します.
+// 一致する部分がなければ nil を返します.
+func FindAllIndex(c CharClass, pat Pattern, s string, n int) [][2]int {
+	return findAllIndex(c, pat, s, n, false)
+}
+
+// FindAllOverlapIndex は s の中から pat と一致する範囲を, 重なりを含めて最大 n 個返します.
+//
+// 直前の一致の開始位置の次の文字から検索を続けるので, 一致する開始位置ごとにひとつの範囲を返します.
+// n が負のときはすべての範囲を返します.
+// 一致する部分がなければ nil を返します.
+func FindAllOverlapIndex(c CharClass, pat Pattern, s string, n int) [][2]int {
+	return findAllIndex(c, pat, s, n, true)
+}
+
+// findAllIndex は FindAllIndex, FindAllOverlapIndex の範囲を返します.
+func findAllIndex(c CharClass, pat Pattern, s string, n int, overlap bool) [][2]int {
+	if n == 0 {
+		return nil
+	}
+	var v [][2]int
+	fd := finderOf(c, pat)
+	fd.all(s, overlap, func(f, l int) bool {
+		v = append(v, [2]int{f, l})
+		return len(v) != n
+	})
+	return v
+}
+
+// First は pat にマッチする文字列の先頭文字の CharClass を返します.
+//
+// patb の Pattern の組み合わせから先頭文字を求めます.
+// 独自の Pattern 関数から始まる場合や空文字列とマッチし得る場合は
+// 先頭文字を特定できないので All を返します.
+func First(pat Pattern) CharClass {
+	return nodeOf(pat).leading()
+}
+
+// FindSubmatchIndex は s[i:] から pat に一致する範囲とサブマッチの範囲を返します.
+//
+// 戻り値の m[0], m[1] はパターンに一致した範囲,
+// m[2*k], m[2*k+1] は k 番目のサブマッチの範囲です.
+// マッチしなかったサブマッチの範囲は -1, -1 です.
+// 一致する部分がなければ nil を返します.
+func FindSubmatchIndex(c CharClass, pat Pattern, s string, i int) []int {
+	f, l := FindIndex(c, pat, s, i)
+	if f < 0 {
+		return nil
+	}
+	return submatchIndex(nodeOf(pat), s, f, l)
+}
+
+// submatchIndex は s[f:l] に一致した n のサブマッチの範囲を返します.
+func submatchIndex(n *node, s string, f, l int) []int {
+	m := make([]int, 2*len(n.names)+2)
+	for k := range m {
+		m[k] = -1
+	}
+	m[0], m[1] = f, l
+	n.match(&machine{caps: m}, s, f, 0)
+	return m
+}
+
+// FindSubmatch は s[i:] から pat に一致する文字列とサブマッチの文字列を返します.
+//
+// 戻り値の m[0] はパターンに一致した文字列, m[k] は k 番目のサブマッチの文字列です.
+// マッチしなかったサブマッチは空文字列です.
+// 一致する部分がなければ nil を返します.
+func FindSubmatch(c CharClass, pat Pattern, s string, i int) []string {
+	return submatch(s, FindSubmatchIndex(c, pat, s, i))
+}
+
+// submatch は範囲 m のサブマッチの文字列を返します.
+func submatch(s string, m []int) []string {
+	if m == nil {
+		return nil
+	}
+	v := make([]string, len(m)/2)
+	for k := range v {
+		if f := m[2*k]; f >= 0 {
+			v[k] = s[f:m[2*k+1]]
 		}
-		f = l
 	}
+	return v
+}
+
+// FindAllSubmatchFunc は s の中から pat と一致する文字列とサブマッチの文字列を fn に渡します.
+// m の内容は FindSubmatch と同じです.
+// fn が error を返すとそのエラーを返します.
+func FindAllSubmatchFunc(c CharClass, pat Pattern, s string, fn func(m []string) error) error {
+	var err error
+	n := nodeOf(pat)
+	fd := finderOf(c, pat)
+	fd.all(s, false, func(f, l int) bool {
+		err = fn(submatch(s, submatchIndex(n, s, f, l)))
+		return err == nil
+	})
+	return err
+}
+
+// SubexpNames は pat に含まれるサブマッチの名前を返します.
+//
+// names[k] は k 番目のサブマッチの名前です. names[0] は常に空文字列です.
+// 名前のないサブマッチは空文字列です.
+func SubexpNames(pat Pattern) []string {
+	return append([]string{""}, nodeOf(pat).names...)
 }
 
 // ReplaceWrite は Writer を使って文字列を置換します.
@@ -74,26 +177,109 @@ func FindAllFunc(c CharClass, pat Pattern, s string, fn func(m string) error) er
 // コールバック関数はパターンに一致した文字列を受け取り, 対応する置換文字列を Writer に書き込みます.
 // コールバック関数が SkipAll を返すと, 以降の置換をスキップします.
 // それ以外の error を返された場合, ReplaceWrite はその error を返します.
+//
+// 空文字列に一致する部分の扱いは regexp パッケージと同じです.
+// 空文字列に一致すると次の文字から検索を続け, 直前の一致の終わりに接する空文字列の一致は置換しません.
 func ReplaceWrite(w Writer, c CharClass, pat Pattern, s string, fn func(w Writer, m string) error) error {
+	var err error
 	i := 0
-	for {
-		f, l := FindIndex(c, pat, s, i)
-		if f < 0 {
-			w.WriteString(s[i:])
-			break
+	fd := finderOf(c, pat)
+	fd.all(s, false, func(f, l int) bool {
+		if i < f {
+			w.WriteString(s[i:f])
+		}
+		err, i = fn(w, s[f:l]), l
+		return err == nil
+	})
+	if err != nil && err != SkipAll {
+		return err
+	}
+	w.WriteString(s[i:])
+	return nil
+}
+
+// MatchResult は ReplaceWriteMatch のコールバック関数に渡す一致の情報です.
+type MatchResult struct {
+	Index      int    // 一致した順番 (0 から始まる)
+	Start, End int    // 一致した範囲 s[Start:End]
+	Text       string // 一致した文字列 s[Start:End]
+
+	// Submatches は FindSubmatchIndex と同じ範囲です.
+	// Submatches[2*k], Submatches[2*k+1] は k 番目のサブマッチの範囲です.
+	Submatches []int
+
+	src   string
+	names []string
+}
+
+// Submatch は k 番目のサブマッチの文字列を返します.
+//
+// k が 0 のときは一致した文字列を返します.
+// マッチしなかったサブマッチや範囲外の k は空文字列です.
+func (m MatchResult) Submatch(k int) string {
+	if k < 0 || 2*k+1 >= len(m.Submatches) || m.Submatches[2*k] < 0 {
+		return ""
+	}
+	return m.src[m.Submatches[2*k]:m.Submatches[2*k+1]]
+}
+
+// SubexpIndex は名前が name のサブマッチの番号を返します.
+//
+// name のサブマッチがなければ -1 を返します.
+func (m MatchResult) SubexpIndex(name string) int {
+	if name != "" {
+		for k, s := range m.names {
+			if s == name {
+				return k + 1
+			}
 		}
+	}
+	return -1
+}
+
+// ReplaceWriteMatch は ReplaceWrite と同じく Writer を使って文字列を置換します.
+//
+// コールバック関数は一致した位置やサブマッチを MatchResult で受け取ります.
+// 一致した範囲の一部だけを書き換えるときに使用します.
+//
+//	// <sip:user@host> の user だけを *** に置き換えます.
+//	ReplaceWriteMatch(w, nil, pat, s, func(w Writer, m MatchResult) error {
+//		k := m.SubexpIndex("user")
+//		if k < 0 || m.Submatches[2*k] < 0 {
+//			// user がないか, user がマッチしていません.
+//			w.WriteString(m.Text)
+//			return nil
+//		}
+//		w.WriteString(s[m.Start:m.Submatches[2*k]])
+//		w.WriteString("***")
+//		w.WriteString(s[m.Submatches[2*k+1]:m.End])
+//		return nil
+//	})
+func ReplaceWriteMatch(w Writer, c CharClass, pat Pattern, s string, fn func(w Writer, m MatchResult) error) error {
+	var err error
+	i, k := 0, 0
+	n := nodeOf(pat)
+	fd := finderOf(c, pat)
+	fd.all(s, false, func(f, l int) bool {
 		if i < f {
 			w.WriteString(s[i:f])
 		}
-		err := fn(w, s[f:l])
-		if err == SkipAll {
-			w.WriteString(s[l:])
-			break
-		} else if err != nil {
-			return err
+		m := MatchResult{
+			Index:      k,
+			Start:      f,
+			End:        l,
+			Text:       s[f:l],
+			Submatches: submatchIndex(n, s, f, l),
+			src:        s,
+			names:      n.names,
 		}
-		i = l
+		err, i, k = fn(w, m), l, k+1
+		return err == nil
+	})
+	if err != nil && err != SkipAll {
+		return err
 	}
+	w.WriteString(s[i:])
 	return nil
 }
 
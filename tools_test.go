@@ -3,28 +3,27 @@ package patb
 import (
 	"bytes"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 )
 
 func TestEqual(t *testing.T) {
-	name := "[[:alpha:]]{3,5}"
 	al35 := Ch(3, 5, Alphabet())
 
 	tests := []struct {
-		name string
 		pat  Pattern
 		s    string
 		want bool
 	}{
-		{name, al35, "abc", true},
-		{name, al35, "abcde", true},
-		{name, al35, "abcdef", false},
+		{al35, "abc", true},
+		{al35, "abcde", true},
+		{al35, "abcdef", false},
 	}
 	for _, te := range tests {
 		got := Equal(te.pat, te.s)
 		if got != te.want {
-			t.Errorf("Equal(`%s`, %q) = %t, want %t", te.name, te.s, got, te.want)
+			t.Errorf("Equal(`%s`, %q) = %t, want %t", te.pat, te.s, got, te.want)
 		}
 	}
 }
@@ -74,6 +73,52 @@ func TestFindIndex(t *testing.T) {
 	}
 }
 
+func TestFirst(t *testing.T) {
+	tests := []struct {
+		name string
+		pat  Pattern
+		want map[rune]bool
+	}{
+		{`abc`, S("abc"), map[rune]bool{
+			'a': true, 'b': false, 'あ': false,
+		}},
+		{`(?i)sip`, SFold("sip"), map[rune]bool{
+			's': true, 'S': true, 'i': false,
+		}},
+		{`\d{1,3}`, Ch(1, 3, Digit()), map[rune]bool{
+			'0': true, 'a': false, 'あ': false,
+		}},
+		{`(x|あ)`, Any(S("x"), S("あ")), map[rune]bool{
+			'x': true, 'a': false, 'あ': true,
+		}},
+		{`(a?b)+`, Repeat(1, 3, Ch(0, 1, C("a")), S("b")), map[rune]bool{
+			'a': true, 'b': true, 'c': false,
+		}},
+		{`^\s?(@|#)`, Block(Head(), Ch(0, 1, Space()), Any(S("@"), S("#"))), map[rune]bool{
+			' ': true, '@': true, '#': true, 'a': false,
+		}},
+		{`\d*`, Ch(0, 3, Digit()), map[rune]bool{
+			'0': true, 'a': true, 'あ': true,
+		}},
+		{`func`, Pattern(func(s string, i int) int { return -1 }), map[rune]bool{
+			'0': true, 'a': true, 'あ': true,
+		}},
+	}
+	for _, te := range tests {
+		c := First(te.pat)
+		for r, want := range te.want {
+			if got := c(r); got != want {
+				t.Errorf("First(`%s`) ('%c') = %t, want %t", te.name, r, got, want)
+			}
+		}
+	}
+
+	f, l := FindIndex(nil, Block(S("@"), Ch(0, 2, Digit())), "#0 <= @1", 0)
+	if f != 6 || l != 8 {
+		t.Errorf("FindIndex(nil) = %d, %d, want 6, 8", f, l)
+	}
+}
+
 func TestFindAllFunc(t *testing.T) {
 	tests := []struct {
 		name string
@@ -97,6 +142,140 @@ func TestFindAllFunc(t *testing.T) {
 	}
 }
 
+func TestFindAllIndex(t *testing.T) {
+	word := Ch(1, 16, Not(" "))
+	tests := []struct {
+		name    string
+		pat     Pattern
+		s       string
+		n       int
+		overlap bool
+		want    [][2]int
+	}{
+		{`[^ ]{1,16}`, word, "abc あいう x", -1, false, [][2]int{{0, 3}, {4, 13}, {14, 15}}},
+		{`[^ ]{1,16}`, word, "abc あいう x", 2, false, [][2]int{{0, 3}, {4, 13}}},
+		{`[^ ]{1,16}`, word, "abc あいう x", 0, false, nil},
+		{`[^ ]{1,16}`, word, "   ", -1, false, nil},
+		{`[^ ]{1,16}`, word, "ab あ", -1, true, [][2]int{{0, 2}, {1, 2}, {3, 6}}},
+		{`aba`, S("aba"), "ababa", -1, false, [][2]int{{0, 3}}},
+		{`aba`, S("aba"), "ababa", -1, true, [][2]int{{0, 3}, {2, 5}}},
+		{`aba`, S("aba"), "ababa", 1, true, [][2]int{{0, 3}}},
+	}
+	for _, te := range tests {
+		var got [][2]int
+		if te.overlap {
+			got = FindAllOverlapIndex(nil, te.pat, te.s, te.n)
+		} else {
+			got = FindAllIndex(nil, te.pat, te.s, te.n)
+		}
+		if !reflect.DeepEqual(got, te.want) {
+			t.Errorf("FindAllIndex(`%s`, %q, %d, %t) = %v, want %v", te.name, te.s, te.n, te.overlap, got, te.want)
+		}
+	}
+}
+
+func TestFindAllEmpty(t *testing.T) {
+	tests := []struct {
+		expr string
+		pat  Pattern
+	}{
+		{`\d{0,5}`, Ch(0, 5, Digit())},
+		{`(?:ab)?`, Repeat(0, 1, S("ab"))},
+		{`^`, Head()},
+		{`$`, Tail()},
+		{`a|`, Any(S("a"), S(""))},
+		{`x*`, Ch(0, 16, C("x"))},
+	}
+	texts := []string{"", "abc", "12ab345", "あa1い", "ab\xffab"}
+	for _, te := range tests {
+		re := regexp.MustCompile(te.expr)
+		for _, s := range texts {
+			want := re.FindAllStringIndex(s, -1)
+			var got [][]int
+			for _, m := range FindAllIndex(nil, te.pat, s, -1) {
+				got = append(got, []int{m[0], m[1]})
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("FindAllIndex(`%s`, %q) = %v, want %v", te.expr, s, got, want)
+			}
+
+			var all []string
+			FindAllFunc(All(), te.pat, s, func(m string) error {
+				all = append(all, m)
+				return nil
+			})
+			if want := re.FindAllString(s, -1); !reflect.DeepEqual(all, want) {
+				t.Errorf("FindAllFunc(`%s`, %q) = %q, want %q", te.expr, s, all, want)
+			}
+
+			if got, want := ReplaceAll(nil, te.pat, s, "-"), re.ReplaceAllLiteralString(s, "-"); got != want {
+				t.Errorf("ReplaceAll(`%s`, %q) = %q, want %q", te.expr, s, got, want)
+			}
+			if got, want := ReplaceAllBytes(nil, te.pat, []byte(s), []byte("-")), re.ReplaceAllLiteral([]byte(s), []byte("-")); !bytes.Equal(got, want) {
+				t.Errorf("ReplaceAllBytes(`%s`, %q) = %q, want %q", te.expr, s, got, want)
+			}
+		}
+	}
+}
+
+func TestFindSubmatchIndex(t *testing.T) {
+	// `<sip:(([^@]+)@)?([^>:]*)(:(\d{1,5}))?>`
+	pat := Block(
+		S("<sip:"),
+		Repeat(0, 1, Capture(NamedCapture("user", Ch(1, 256, Not("@"))), S("@"))),
+		NamedCapture("host", Ch(0, 256, Not(">:"))),
+		Repeat(0, 1, Capture(S(":"), NamedCapture("port", Ch(1, 5, Digit())))),
+		S(">"),
+	)
+
+	tests := []struct {
+		s    string
+		want []int
+	}{
+		{`"display_name"<sip:0312341234@10.0.0.1:5060>;user=phone`, []int{14, 44, 19, 30, 19, 29, 30, 38, 38, 43, 39, 43}},
+		{`<sip:0312341234@10.0.0.1>`, []int{0, 25, 5, 16, 5, 15, 16, 24, -1, -1, -1, -1}},
+		{`<sip:whois.this>;user=phone`, []int{0, 16, -1, -1, -1, -1, 5, 15, -1, -1, -1, -1}},
+		{`<tel:0312341234>`, nil},
+	}
+	for _, te := range tests {
+		got := FindSubmatchIndex(C("<"), pat, te.s, 0)
+		if !reflect.DeepEqual(got, te.want) {
+			t.Errorf("FindSubmatchIndex(%q) = %v, want %v", te.s, got, te.want)
+		}
+	}
+
+	names := SubexpNames(pat)
+	if want := []string{"", "", "user", "host", "", "port"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("SubexpNames() = %q, want %q", names, want)
+	}
+}
+
+func TestFindSubmatch(t *testing.T) {
+	// `(\w+)=(\w*)`
+	pat := Block(Capture(Ch(1, 16, Word())), S("="), Capture(Ch(0, 16, Word())))
+
+	got := FindSubmatch(Word(), pat, "user=phone;lr=", 0)
+	if want := []string{"user=phone", "user", "phone"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindSubmatch() = %q, want %q", got, want)
+	}
+
+	var all [][]string
+	FindAllSubmatchFunc(Word(), pat, "user=phone;lr=", func(m []string) error {
+		all = append(all, m)
+		return nil
+	})
+	if want := [][]string{{"user=phone", "user", "phone"}, {"lr=", "lr", ""}}; !reflect.DeepEqual(all, want) {
+		t.Errorf("FindAllSubmatchFunc() = %q, want %q", all, want)
+	}
+
+	// `<(.*)>(.*)`
+	pat = Backtrack(S("<"), Capture(Ch(0, 256, All())), S(">"), Capture(Ch(0, 256, All())))
+	got = FindSubmatch(C("<"), pat, "<a>b>c", 0)
+	if want := []string{"<a>b>c", "a>b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindSubmatch() = %q, want %q", got, want)
+	}
+}
+
 func TestReplaceWrite(t *testing.T) {
 	tests := []struct {
 		name string
@@ -279,3 +458,67 @@ func TestPostalBanchiKanji(t *testing.T) {
 		}
 	}
 }
+
+func TestReplaceWriteMatch(t *testing.T) {
+	// `<sip:(?P<user>[^@>]+@)?(?P<host>[^>]*)>`
+	pat := Block(
+		S("<sip:"),
+		Repeat(0, 1, NamedCapture("user", Ch(1, 32, Not("@>"))), S("@")),
+		NamedCapture("host", Ch(0, 32, Not(">"))),
+		S(">"),
+	)
+	s := `"a"<sip:0312341234@10.0.0.1>;<sip:whois.this>,<sip:x@y>`
+	var w bytes.Buffer
+	var got []MatchResult
+	mask := func(name string) func(w Writer, m MatchResult) error {
+		return func(w Writer, m MatchResult) error {
+			got = append(got, m)
+			if k := m.SubexpIndex(name); k >= 0 && m.Submatches[2*k] >= 0 {
+				w.WriteString(s[m.Start:m.Submatches[2*k]])
+				w.WriteString("***")
+				w.WriteString(s[m.Submatches[2*k+1]:m.End])
+			} else {
+				w.WriteString(m.Text)
+			}
+			return nil
+		}
+	}
+	if err := ReplaceWriteMatch(&w, nil, pat, s, mask("port")); err != nil || w.String() != s {
+		t.Errorf("ReplaceWriteMatch(port) = %q, %v, want %q", w.String(), err, s)
+	}
+	w.Reset()
+	got = nil
+	err := ReplaceWriteMatch(&w, nil, pat, s, mask("user"))
+	if err != nil {
+		t.Errorf("ReplaceWriteMatch() errored %v", err)
+	}
+	if got, want := w.String(), `"a"<sip:***@10.0.0.1>;<sip:whois.this>,<sip:***@y>`; got != want {
+		t.Errorf("ReplaceWriteMatch() = %q, want %q", got, want)
+	}
+	if len(got) != 3 {
+		t.Fatalf("ReplaceWriteMatch() called %d times, want 3", len(got))
+	}
+	for k, m := range got {
+		if want := FindSubmatchIndex(nil, pat, s, m.Start); m.Index != k || m.Text != s[m.Start:m.End] || !reflect.DeepEqual(m.Submatches, want) {
+			t.Errorf("ReplaceWriteMatch() [%d] = %+v, want %v", k, m, want)
+		}
+	}
+	if got, want := got[1].Submatch(2), "whois.this"; got != want {
+		t.Errorf("Submatch(2) = %q, want %q", got, want)
+	}
+	if got := got[1].Submatch(1) + got[1].Submatch(3) + got[1].Submatch(-1); got != "" {
+		t.Errorf("Submatch(1, 3, -1) = %q, want \"\"", got)
+	}
+	if got := got[0].SubexpIndex("port"); got != -1 {
+		t.Errorf("SubexpIndex(port) = %d, want -1", got)
+	}
+
+	w.Reset()
+	err = ReplaceWriteMatch(&w, nil, pat, s, func(w Writer, m MatchResult) error {
+		w.WriteString("-")
+		return SkipAll
+	})
+	if got, want := w.String(), `"a"-;<sip:whois.this>,<sip:x@y>`; err != nil || got != want {
+		t.Errorf("ReplaceWriteMatch(SkipAll) = %q, %v, want %q", got, err, want)
+	}
+}